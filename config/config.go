@@ -27,4 +27,25 @@ const (
 	MagicX        = -99
 	Chatty        = true
 	RootName      = "volley/player"
+	// Reported to the master by each player.
+	Version = "0.2"
+	// Where the master keeps saved layouts, under the home directory.
+	LayoutDir = ".volley/layouts"
+	// Environment variable that names the namespace root, as
+	// host:port, if not given by flag.
+	NamespaceRootEnv = "VOLLEY_NAMESPACE_ROOT"
+	// Where the last namespace root that worked is kept, under the
+	// home directory.
+	NamespaceRootCache = ".volley/nsroot"
+	// Multicast group that beacons announcing the namespace root are
+	// sent to.
+	DiscoveryAddr = "239.255.86.1:8102"
+	// If true, a player that finds no namespace root runs a mounttable
+	// itself, at MountTablePort, so the first device to launch in a
+	// room hosts the game.
+	HostNamespaceIfAlone = true
+	// How players reach each other, unless the -transport flag says
+	// otherwise: "v23", or "tcp" for JSON-RPC over plain TCP, which
+	// needs no v23 credentials.  Everyone in a room must agree.
+	Transport = "v23"
 )
@@ -0,0 +1,176 @@
+// Package discovery finds the namespace root on the local network.
+//
+// Players that reached a mounttable announce its address in small UDP
+// beacons, sent every Interval to a multicast group, so a device new to
+// the room can find the mounttable without anyone typing its address.
+// Any UDP address works, so tests announce to and listen on loopback.
+package discovery
+
+import (
+	"errors"
+	"github.com/monopole/volley/config"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	// How often a beacon is sent.
+	Interval = time.Second
+	// How long to listen for a beacon before giving up; a few
+	// intervals, so a lost datagram or two doesn't matter.
+	Wait = 3 * Interval
+	// Beacons are this prefix followed by the root, as host:port.
+	prefix = "v23.namespace.root="
+	// Longest beacon read; longer ones are truncated, and ignored.
+	maxBeacon = 512
+)
+
+var errNoRoot = errors.New("beacon holds no namespace root")
+
+// Beacon announces a namespace root until stopped.
+type Beacon struct {
+	conn   net.Conn
+	chStop chan bool
+}
+
+// Announce sends a beacon holding root to addr now and every interval
+// after, until the returned beacon is stopped.
+func Announce(addr, root string, interval time.Duration) (*Beacon, error) {
+	conn, err := net.Dial("udp4", addr)
+	if err != nil {
+		return nil, err
+	}
+	b := &Beacon{conn, make(chan bool)}
+	go b.run([]byte(prefix+root), interval)
+	return b, nil
+}
+
+func (b *Beacon) run(msg []byte, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer b.conn.Close()
+	for {
+		if _, err := b.conn.Write(msg); err != nil && config.Chatty {
+			log.Printf("Beacon not sent: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-b.chStop:
+			return
+		}
+	}
+}
+
+// Stop ends the announcements.
+func (b *Beacon) Stop() {
+	close(b.chStop)
+}
+
+// Listener hears beacons sent to an address.
+type Listener struct {
+	conn *net.UDPConn
+}
+
+// Listen for beacons sent to addr, joining the group if it's a
+// multicast address.
+func Listen(addr string) (*Listener, error) {
+	ua, err := net.ResolveUDPAddr("udp4", addr)
+	if err != nil {
+		return nil, err
+	}
+	var conn *net.UDPConn
+	if ua.IP.IsMulticast() {
+		conn, err = net.ListenMulticastUDP("udp4", nil, ua)
+	} else {
+		conn, err = net.ListenUDP("udp4", ua)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Listener{conn}, nil
+}
+
+// Addr is where the listener hears beacons, with the port filled in
+// if Listen was given port 0.
+func (l *Listener) Addr() string {
+	return l.conn.LocalAddr().String()
+}
+
+// Next returns the root in the next beacon heard, skipping anything
+// that isn't a beacon, or an error if none arrives within wait.
+func (l *Listener) Next(wait time.Duration) (string, error) {
+	if err := l.conn.SetReadDeadline(time.Now().Add(wait)); err != nil {
+		return "", err
+	}
+	buf := make([]byte, maxBeacon)
+	for {
+		n, _, err := l.conn.ReadFromUDP(buf)
+		if err != nil {
+			return "", err
+		}
+		root, err := parse(string(buf[:n]))
+		if err == nil {
+			return root, nil
+		}
+		if config.Chatty {
+			log.Printf("Ignoring datagram: %v", err)
+		}
+	}
+}
+
+func (l *Listener) Close() error {
+	return l.conn.Close()
+}
+
+func parse(msg string) (string, error) {
+	if !strings.HasPrefix(msg, prefix) {
+		return "", errNoRoot
+	}
+	root := msg[len(prefix):]
+	if _, _, err := net.SplitHostPort(root); err != nil {
+		return "", err
+	}
+	return root, nil
+}
+
+// Find listens on addr for up to wait, and returns the root in the
+// first beacon heard.
+func Find(addr string, wait time.Duration) (string, error) {
+	l, err := Listen(addr)
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+	return l.Next(wait)
+}
+
+// LocalRoot returns a root at the given port on this host, using its
+// first IPv4 address other than loopback, so that other devices can
+// reach it, or loopback if it has no other.
+func LocalRoot(port string) string {
+	host := "127.0.0.1"
+	addrs, err := net.InterfaceAddrs()
+	if err == nil {
+		for _, a := range addrs {
+			ipn, ok := a.(*net.IPNet)
+			if ok && !ipn.IP.IsLoopback() && ipn.IP.To4() != nil {
+				host = ipn.IP.String()
+				break
+			}
+		}
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// Reachable is true if something accepts connections at root, as
+// host:port, within wait.  It doesn't check that it's a mounttable.
+func Reachable(root string, wait time.Duration) bool {
+	conn, err := net.DialTimeout("tcp", root, wait)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
@@ -0,0 +1,76 @@
+package discovery
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func listen(t *testing.T) *Listener {
+	l, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return l
+}
+
+func TestBeaconIsHeard(t *testing.T) {
+	l := listen(t)
+	defer l.Close()
+	// Noise on the port first.
+	conn, err := net.Dial("udp4", l.Addr())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	conn.Write([]byte("hello"))
+	conn.Write([]byte(prefix + "no port"))
+	conn.Close()
+
+	b, err := Announce(l.Addr(), "192.168.1.5:23000", 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer b.Stop()
+	for i := 0; i < 2; i++ {
+		root, err := l.Next(time.Second)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if root != "192.168.1.5:23000" {
+			t.Errorf("got root %q", root)
+		}
+	}
+}
+
+func TestNothingHeard(t *testing.T) {
+	l := listen(t)
+	defer l.Close()
+	if root, err := l.Next(20 * time.Millisecond); err == nil {
+		t.Errorf("heard %q in silence", root)
+	}
+}
+
+func TestReachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	addr := ln.Addr().String()
+	if !Reachable(addr, time.Second) {
+		t.Errorf("%s not reachable while listening", addr)
+	}
+	ln.Close()
+	if Reachable(addr, time.Second) {
+		t.Errorf("%s reachable after closing", addr)
+	}
+}
+
+func TestLocalRoot(t *testing.T) {
+	host, port, err := net.SplitHostPort(LocalRoot("23000"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if port != "23000" || net.ParseIP(host).To4() == nil {
+		t.Errorf("got %s:%s", host, port)
+	}
+}
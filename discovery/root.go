@@ -0,0 +1,137 @@
+package discovery
+
+import (
+	"github.com/monopole/volley/config"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// How long a cached namespace root has to accept a connection.
+const cacheCheckWait = time.Second
+
+// Ways of finding the namespace root, tried in order.  Each returns
+// the empty string if it knows nothing.
+type rootFinder struct {
+	chatty    bool
+	host      bool // Run the mounttable here regardless.
+	alone     bool // Run the mounttable here if none is found.
+	flagRoot  string
+	getenv    func(string) string
+	cacheFile string
+	reachable func(root string) bool
+	discover  func() (string, error)
+	localRoot func() string
+}
+
+func defaultRootFinder(root string, host bool, isGameMaster bool) *rootFinder {
+	return &rootFinder{
+		config.Chatty,
+		host,
+		// The master comes and goes, so mustn't host by default.
+		config.HostNamespaceIfAlone && !isGameMaster,
+		root,
+		os.Getenv,
+		filepath.Join(os.Getenv("HOME"), config.NamespaceRootCache),
+		func(root string) bool {
+			return Reachable(root, cacheCheckWait)
+		},
+		func() (string, error) {
+			return Find(config.DiscoveryAddr, Wait)
+		},
+		func() string {
+			return LocalRoot(config.MountTablePort)
+		},
+	}
+}
+
+// The root from the flag, else the environment, else the cache if
+// something still answers there, else a beacon, else the compiled-in
+// default.  If the bool is true, the root is this host's and the
+// caller is to run the mounttable.
+func (f *rootFinder) find() (string, bool) {
+	if f.host {
+		return f.hosted()
+	}
+	if f.flagRoot != "" {
+		return f.found("flag", f.flagRoot)
+	}
+	if root := f.getenv(config.NamespaceRootEnv); root != "" {
+		return f.found("$"+config.NamespaceRootEnv, root)
+	}
+	if root := f.cached(); root != "" && f.reachable(root) {
+		return f.found("cache", root)
+	}
+	root, err := f.discover()
+	if err == nil {
+		return f.found("beacon", root)
+	}
+	if f.chatty {
+		log.Printf("No namespace root beacon heard: %v", err)
+	}
+	if f.alone {
+		return f.hosted()
+	}
+	return f.found("default", strings.TrimPrefix(config.NamespaceRoot, "/"))
+}
+
+func (f *rootFinder) found(how, root string) (string, bool) {
+	if f.chatty {
+		log.Printf("Namespace root %s from %s.", root, how)
+	}
+	return root, false
+}
+
+func (f *rootFinder) hosted() (string, bool) {
+	root := f.localRoot()
+	if f.chatty {
+		log.Printf("Hosting namespace root %s.", root)
+	}
+	return root, true
+}
+
+func (f *rootFinder) cached() string {
+	data, err := ioutil.ReadFile(f.cacheFile)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// Remember root as the last one that worked.
+func (f *rootFinder) remember(root string) error {
+	if err := os.MkdirAll(filepath.Dir(f.cacheFile), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(f.cacheFile, []byte(root+"\n"), 0644)
+}
+
+// DetermineRoot returns the namespace root, as host:port, from root,
+// as given by the user, say with a -ns-root flag, the environment
+// variable config.NamespaceRootEnv, the last root a player here reached
+// if it still answers, or a beacon from a player on the local network,
+// in that order.  Failing all of those it returns config.NamespaceRoot.
+//
+// The root is wherever the transport keeps its directory of players: a
+// mounttable for v23, a registry for tcp.  The bool is true if the
+// caller is to host it itself, as host asks, or as a player that found
+// no root does if config.HostNamespaceIfAlone.  The root is then this
+// host's, at config.MountTablePort.  Two players launched at once may
+// both end up hosting, and so play apart.
+func DetermineRoot(root string, host bool, isGameMaster bool) (string, bool) {
+	return defaultRootFinder(root, host, isGameMaster).find()
+}
+
+// Publish remembers root as the last one that worked, and announces
+// it to players yet to find it until the returned beacon is stopped.
+// Call it once the root has been reached, or is being hosted.
+func Publish(root string, isGameMaster bool) (*Beacon, error) {
+	f := defaultRootFinder("", false, isGameMaster)
+	if err := f.remember(root); err != nil {
+		log.Printf("Unable to cache namespace root: %v", err)
+	}
+	return Announce(config.DiscoveryAddr, root, Interval)
+}
@@ -0,0 +1,85 @@
+package discovery
+
+import (
+	"errors"
+	"fmt"
+	"github.com/monopole/volley/config"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testRootFinder(dir string) *rootFinder {
+	return &rootFinder{
+		false,
+		false,
+		false,
+		"",
+		func(string) string { return "" },
+		filepath.Join(dir, "nsroot"),
+		func(root string) bool { return root == "10.0.0.3:23000" },
+		func() (string, error) { return "", errors.New("silence") },
+		func() string { return "10.0.0.9:23000" },
+	}
+}
+
+// The root found, or what went wrong.
+func find(f *rootFinder, want string, host bool) string {
+	got, gotHost := f.find()
+	if got != want || gotHost != host {
+		return fmt.Sprintf("got %q, %v; want %q, %v", got, gotHost, want, host)
+	}
+	return ""
+}
+
+func TestFindNamespaceRoot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nsroot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f := testRootFinder(dir)
+	if e := find(f, config.NamespaceRoot[1:], false); e != "" {
+		t.Errorf("with nothing to go on, %s", e)
+	}
+	f.alone = true
+	if e := find(f, "10.0.0.9:23000", true); e != "" {
+		t.Errorf("alone, %s", e)
+	}
+	f.discover = func() (string, error) { return "10.0.0.2:23000", nil }
+	if e := find(f, "10.0.0.2:23000", false); e != "" {
+		t.Errorf("%s, want the beacon's root", e)
+	}
+	// A cached root that no longer answers loses to a beacon.
+	if err := f.remember("10.0.0.1:23000"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e := find(f, "10.0.0.2:23000", false); e != "" {
+		t.Errorf("%s, want the beacon's root", e)
+	}
+	if err := f.remember("10.0.0.3:23000"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e := find(f, "10.0.0.3:23000", false); e != "" {
+		t.Errorf("%s, want the cached root", e)
+	}
+	f.getenv = func(k string) string {
+		if k == config.NamespaceRootEnv {
+			return "10.0.0.4:23000"
+		}
+		return ""
+	}
+	if e := find(f, "10.0.0.4:23000", false); e != "" {
+		t.Errorf("%s, want the environment's root", e)
+	}
+	f.flagRoot = "10.0.0.5:23000"
+	if e := find(f, "10.0.0.5:23000", false); e != "" {
+		t.Errorf("%s, want the flag's root", e)
+	}
+	f.host = true
+	if e := find(f, "10.0.0.9:23000", true); e != "" {
+		t.Errorf("%s, want to host", e)
+	}
+}
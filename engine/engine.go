@@ -5,6 +5,7 @@ import (
 	"github.com/monopole/volley/config"
 	"github.com/monopole/volley/ifc"
 	"github.com/monopole/volley/model"
+	"github.com/monopole/volley/physics"
 	"github.com/monopole/volley/screen"
 	"golang.org/x/mobile/app"
 	"golang.org/x/mobile/event/key"
@@ -25,38 +26,64 @@ const (
 	debugShowResizes           = false
 	maxHoldCount               = 30
 	magicButtonSideLength      = 100
-	fuzzyZero                  = 0.1
 	minDragLength              = 6
+
+	// Physics advances in fixed steps of this many seconds, however
+	// often the device manages to paint.
+	stepDuration = float32(1.0 / 60)
+	// Cap on time owed to physics, so a stall (e.g. a slow RPC or a
+	// backgrounded app) doesn't fling balls across the screen at once.
+	maxLag = float32(0.25)
+	// Seconds for a ball with unit velocity to cross the screen.
+	defaultPauseDuration = 3
+	// Speed, in screen crossings per pause duration, of balls that
+	// are swiped, kicked or sent left or right.
+	impulseSpeed = 4
+	// Slowest speed a ball may have when discarded through a door.
+	minSpeed = 0.1
+	// Most seconds of flight time to make up for when a ball arrives.
+	// Guards against wildly wrong clock offset estimates.
+	maxFlightTime = float32(1)
 )
 
 type Engine struct {
 	isAlive             bool
 	maxDistSqForImpulse float32
-	gravity             float32
 	nm                  model.NetManager
 	scn                 model.Screen
 	chatty              bool
-	balls               []*model.Ball
 	touchX              float32
 	touchY              float32
 	beginX              float32
 	beginY              float32
-	leftDoor            model.DoorState
-	rightDoor           model.DoorState
 	chBallCommand       chan model.BallCommand // Owned, written to.
-	// A time unit representing how much time (in some unspecified time
-	// unit) between each paint event.  Making this number smaller makes
-	// balls move faster.
-	pauseDuration float32
-
-	// Window height and width are provided in "pixels".
-	// Velocity == "pixels traversed per timeStep".
-	pixelsToCrossDuringPause float32
+	// Holds the balls, doors, gravity and pause duration.  Time in the
+	// world is in seconds, so the pause duration is the number of
+	// seconds a ball with unit velocity needs to cross the screen,
+	// however big the screen and however fast it repaints.  Making it
+	// smaller makes balls move faster.
+	world *physics.World
+	// When physics last caught up with the clock, and how much time
+	// it still owes (less than one step).
+	lastMove time.Time
+	lag      float32
+	// The physical size of the screen, as last advertised.
+	size model.Dimensions
+	// When the engine was made, for reporting uptime.
+	started time.Time
 }
 
 func NewEngine(
 	chatty bool,
 	nm model.NetManager,
+) *Engine {
+	return newEngine(chatty, nm, screen.NewScreen())
+}
+
+func newEngine(
+	chatty bool,
+	nm model.NetManager,
+	scn model.Screen,
 ) *Engine {
 	if nm == nil {
 		log.Panic("NetManager cannot be nil")
@@ -64,17 +91,16 @@ func NewEngine(
 	return &Engine{
 		false, // isAlive
 		defaultMaxDistSqForImpulse,
-		0, // gravity
 		nm,
-		screen.NewScreen(),
+		scn,
 		chatty,
-		[]*model.Ball{},
 		0, 0, 0, 0,
-		model.Closed, // left door
-		model.Closed, // right door
 		make(chan model.BallCommand),
-		200, // pauseDuration
-		20,  // pixelsToCrossDuringPause
+		physics.NewWorld(0, 0, defaultPauseDuration),
+		time.Time{}, // lastMove
+		0,           // lag
+		model.Dimensions{},
+		time.Now(), // started
 	}
 }
 
@@ -158,6 +184,7 @@ func (gn *Engine) Run(a app.App) {
 	var chGravity <-chan float32
 	var chIncomingBall <-chan *model.Ball
 	var chQuit <-chan bool
+	var chState <-chan chan model.State
 
 	holdCount := 0
 	chWaiting, chIsReady := gn.enterWaitState()
@@ -179,12 +206,15 @@ func (gn *Engine) Run(a app.App) {
 				chGravity = relay.ChGravity()
 				chIncomingBall = relay.ChIncomingBall()
 				chQuit = relay.ChQuit()
+				chState = relay.ChState()
 				gn.scn.Start()
 				if gn.chatty {
 					log.Printf("Started screen.")
 				}
 				gn.createBall()
 				gn.isAlive = true
+				gn.lastMove = time.Now()
+				gn.lag = 0
 				if gn.chatty {
 					log.Printf("Seem to be alive now.")
 				}
@@ -210,9 +240,9 @@ func (gn *Engine) Run(a app.App) {
 			case "random":
 				gn.random()
 			case "destroy":
-				gn.balls = []*model.Ball{}
+				gn.world.Clear()
 			default:
-				log.Print("Don't understand command %v", mc)
+				log.Printf("Don't understand command %v", mc)
 			}
 		case <-chQuit:
 			gn.stop()
@@ -221,28 +251,35 @@ func (gn *Engine) Run(a app.App) {
 			}
 			chWaiting, chIsReady = gn.enterWaitState()
 		case pd := <-chPauseDuration:
-			gn.pauseDuration = pd
+			gn.world.SetPauseDuration(pd)
 		case g := <-chGravity:
-			gn.gravity = g
+			// Gravity arrives as the change in velocity per step.
+			gn.world.SetGravity(g / stepDuration)
 		case b := <-chIncomingBall:
-			nx := b.GetPos().X
-			if nx == config.MagicX {
+			// Assume position normalized before teleport.
+			nx := b.GetPos().X * gn.scn.Width()
+			if b.GetPos().X == config.MagicX {
 				// Ball came in from center of top
 				nx = gn.scn.Width() / 2.0
-			} else if nx >= 0 && nx <= fuzzyZero {
-				// Ball came in from left.
-				nx = 0
-			} else {
-				// Ball came in from right.
-				nx = gn.scn.Width()
 			}
-			// Assume Y component normalized before teleport.
 			ny := b.GetPos().Y * gn.scn.Height()
 			b.SetPos(nx, ny)
-			// TODO: Adjust velocity per refraction-like rules?
-			gn.balls = append(gn.balls, b)
+			if b.Aspect() > 0 {
+				// Keep apparent speed and direction despite the
+				// change in screen shape.
+				v := physics.Refract(b.GetVel(), b.Aspect(), gn.aspect())
+				b.SetVel(v.X, v.Y)
+			}
+			b.SetAspect(gn.aspect())
+			gn.catchUp(b)
+			gn.world.Add(b)
+		case ch := <-chState:
+			ch <- gn.state()
 		case dc := <-gn.nm.ChDoorCommand():
 			gn.handleDoor(dc)
+		case p := <-gn.nm.ChPeerLost():
+			// Doors were already adjusted by the net manager.
+			log.Printf("Lost player %v.", p)
 		case event := <-a.Events():
 			switch e := a.Filter(event).(type) {
 			case lifecycle.Event:
@@ -268,8 +305,8 @@ func (gn *Engine) Run(a app.App) {
 				}
 			case paint.Event:
 				if gn.isAlive {
-					gn.moveBalls()
-					gn.scn.Paint(gn.balls)
+					gn.moveBalls(time.Now())
+					gn.scn.Paint(gn.world.Balls())
 					a.Publish()
 				}
 				a.Send(paint.Event{})
@@ -316,8 +353,8 @@ func (gn *Engine) Run(a app.App) {
 						dy := float64(e.Y - gn.beginY)
 						mag := math.Sqrt(dx*dx + dy*dy)
 						if mag >= minDragLength {
-							ndx := float32(dx/mag) * gn.scn.Width() / gn.pauseDuration
-							ndy := float32(dy/mag) * gn.scn.Height() / gn.pauseDuration
+							ndx := float32(dx/mag) * impulseSpeed
+							ndy := float32(dy/mag) * impulseSpeed
 							b := model.NewBall(nil,
 								model.Vec{gn.beginX, gn.beginY},
 								model.Vec{ndx, ndy})
@@ -334,12 +371,12 @@ func (gn *Engine) Run(a app.App) {
 					holdCount = 0
 				}
 			case size.Event:
-				// TODO: Adjust velocity on resizes - balls should take the
-				// same amount of time to traverse the screen regardless of
-				// the size.
 				sz = e
-				gn.scn.ReSize(float32(sz.WidthPx), float32(sz.HeightPx))
-				gn.resetImpulseLimit()
+				gn.resize(float32(sz.WidthPx), float32(sz.HeightPx))
+				// Let the master size this player's slot in the room.
+				gn.size = model.DimensionsOf(
+					float32(sz.WidthPx), float32(sz.HeightPx), sz.PixelsPerPt)
+				gn.nm.Advertise(gn.size)
 				if gn.chatty && debugShowResizes {
 					log.Printf(
 						"Resize new w=%.2f, new h=%.2f, maxDsqImpulse = %f.2",
@@ -362,7 +399,7 @@ func (gn *Engine) Run(a app.App) {
 }
 
 func (gn *Engine) String() string {
-	return fmt.Sprintf("%v %v", gn.nm.Me(), gn.balls)
+	return fmt.Sprintf("%v %v", gn.nm.Me(), gn.world.Balls())
 }
 
 func (gn *Engine) stop() {
@@ -393,29 +430,24 @@ func (gn *Engine) stop() {
 	}
 }
 
-func (gn *Engine) minVelocity() float32 {
-	return gn.pixelsToCrossDuringPause / gn.pauseDuration
-}
-
 func (gn *Engine) kick() {
 	if gn.chatty {
 		log.Print("Kicking.")
 	}
-	for _, b := range gn.balls {
-		//	b.SetVel(0, gn.minVelocity())
-		b.SetVel(0, gn.scn.Height()/gn.pauseDuration)
+	for _, b := range gn.world.Balls() {
+		b.SetVel(0, impulseSpeed)
 	}
 }
 
 func (gn *Engine) left() {
-	for _, b := range gn.balls {
-		b.SetVel(-gn.scn.Width()/gn.pauseDuration, 0)
+	for _, b := range gn.world.Balls() {
+		b.SetVel(-impulseSpeed, 0)
 	}
 }
 
 func (gn *Engine) right() {
-	for _, b := range gn.balls {
-		b.SetVel(gn.scn.Width()/gn.pauseDuration, 0)
+	for _, b := range gn.world.Balls() {
+		b.SetVel(impulseSpeed, 0)
 	}
 }
 
@@ -423,7 +455,7 @@ func (gn *Engine) freeze() {
 	if gn.chatty {
 		log.Print("Freezing.")
 	}
-	for _, b := range gn.balls {
+	for _, b := range gn.world.Balls() {
 		b.SetVel(0, 0)
 	}
 }
@@ -441,10 +473,9 @@ func (gn *Engine) random() {
 	if gn.chatty {
 		log.Print("Assigning random velocities.")
 	}
-	coefX := float64(gn.scn.Width() / gn.pauseDuration)
-	coefY := float64(gn.scn.Height() / gn.pauseDuration)
-	for _, b := range gn.balls {
-		b.SetVel(float32(coefX*randNorm()), float32(coefY*randNorm()))
+	for _, b := range gn.world.Balls() {
+		b.SetVel(
+			float32(impulseSpeed*randNorm()), float32(impulseSpeed*randNorm()))
 	}
 }
 
@@ -458,146 +489,87 @@ func (gn *Engine) random() {
 // Screen center is (width/2, height/2).
 // The width and height come in as integers - but they
 // seem to be in the same units (pixels).
-func (gn *Engine) moveBalls() {
-	discardPile := []discardable{}
-	velX0 := gn.scn.Width() / gn.pauseDuration
-	velY0 := gn.scn.Height() / gn.pauseDuration
-	for i, b := range gn.balls {
-		dx := b.GetVel().X
-		dy := b.GetVel().Y + gn.gravity
-
-		nx := b.GetPos().X + dx*velX0
-		ny := b.GetPos().Y + dy*velY0
-		if nx <= 0 {
-			// Ball hit left side of screen.
-			if gn.leftDoor == model.Open {
-				nx = 1
-				discardPile = append(discardPile, discardable{i, model.Left})
-			} else {
-				nx = 0
-				dx = -dx
-			}
-		} else if nx >= gn.scn.Width() {
-			// Ball hit right side of screen.
-			if gn.rightDoor == model.Open {
-				nx = 0
-				discardPile = append(discardPile, discardable{i, model.Right})
-			} else {
-				nx = gn.scn.Width()
-				dx = -dx
+//
+// Physics catches up with now, the time of this frame, in fixed
+// steps; time short of a step is owed to the next frame.
+func (gn *Engine) moveBalls(now time.Time) {
+	gn.lag += float32(now.Sub(gn.lastMove).Seconds())
+	gn.lastMove = now
+	if gn.lag > maxLag {
+		gn.lag = maxLag
+	}
+	for gn.lag >= stepDuration {
+		gn.lag -= stepDuration
+		exits := gn.world.Step(stepDuration)
+		if gn.chatty {
+			if len(exits) > 0 {
+				log.Printf("%d balls need to move off screen.", len(exits))
 			}
 		}
-		if ny <= 0 {
-			// Ball hit top of screen.
-			ny = 0
-			dy = -dy
-		} else if ny >= gn.scn.Height() {
-			// Ball hit bottom of screen.
-			ny = gn.scn.Height()
-			dy = -dy
-		}
-		b.SetPos(nx, ny)
-		b.SetVel(dx, dy)
+		gn.throwBalls(exits)
 	}
-	if gn.chatty {
-		if len(discardPile) > 0 {
-			log.Printf("%d balls need to move off screen.", len(discardPile))
-		}
-	}
-	gn.throwBalls(discardPile)
 }
 
-func (gn *Engine) throwBalls(discardPile []discardable) {
-	count := 0
-	for _, discard := range discardPile {
-		i := discard.i - count
+func (gn *Engine) throwBalls(exits []physics.Exit) {
+	for _, e := range exits {
 		if gn.chatty {
-			log.Printf("Throwing ball %v (i=%d, k=%d, count=%d).\n",
-				discard.d, i, discard.i, count)
+			log.Printf("Throwing ball %v: %v\n", e.D, e.B)
 		}
-		count++
-		b := gn.balls[i]
-		if gn.chatty {
-			log.Printf("  ball = %v\n", b)
-		}
-		gn.balls = append(gn.balls[:i], gn.balls[i+1:]...)
-		gn.throwOneBall(b, discard.d)
+		gn.throwOneBall(e.B, e.D)
 	}
 }
 
 func (gn *Engine) throwOneBall(b *model.Ball, direction model.Direction) {
-	// Before throwing, normalize the Y coordinate to a dimensionless
-	// percentage.  Recipient converts it based on their own dimensions,
-	// so that if the ball left one tenth of the way up the screen, it
-	// enters the next screen at the same relative position.
-	b.SetPos(b.GetPos().X, b.GetPos().Y/gn.scn.Height())
+	// Before throwing, normalize the position to dimensionless
+	// percentages.  Recipient converts them based on their own
+	// dimensions, so that if the ball left one tenth of the way up the
+	// screen, it enters the next screen at the same relative position.
+	nx := b.GetPos().X / gn.scn.Width()
+	ny := b.GetPos().Y / gn.scn.Height()
+	// The coordinate across the door tells the recipient which edge
+	// the ball enters by; a ball thrown left enters the next screen on
+	// its right, and a ball thrown up enters the next at its bottom.
+	switch direction {
+	case model.Left:
+		nx = 1
+	case model.Right:
+		nx = 0
+	case model.Up:
+		ny = 1
+	case model.Down:
+		ny = 0
+	}
+	b.SetPos(nx, ny)
+	// Velocity is relative to this screen; tell the recipient its shape.
+	b.SetAspect(gn.aspect())
 	gn.chBallCommand <- model.BallCommand{b, direction}
 }
 
-type discardable struct {
-	i int
-	d model.Direction
-}
-
+// Throw every ball out, so none is lost when this player quits.  Each
+// leaves by the open door its velocity heads most toward, and with no
+// door open, the way it heads anyway; finding nobody there, the
+// manager hands it to the table.
 func (gn *Engine) discardBalls() {
-	if gn.leftDoor == model.Closed && gn.rightDoor == model.Closed {
-		// Nowhere to discard balls.
-		return
-	}
-	minVelocity := gn.minVelocity()
-	discardPile := []discardable{}
-	for i, b := range gn.balls {
-		vx := b.GetVel().X
-		vy := b.GetVel().Y
-		nx := b.GetPos().X
-		if vx < 0 {
-			// Try to discard to left.
-			if gn.leftDoor == model.Open {
-				discardPile = append(discardPile, discardable{i, model.Left})
-				// Ball should appear on right side of place it flies to.
-				nx = gn.scn.Width()
-				if -vx < minVelocity {
-					vx = -minVelocity
-				}
-			} else {
-				if gn.rightDoor == model.Open {
-					discardPile = append(discardPile, discardable{i, model.Right})
-					nx = 0
-					// Make ball go right.
-					if -vx < minVelocity {
-						vx = minVelocity
-					} else {
-						vx = -vx
-					}
-				}
-			}
-		} else {
-			// vx non-negative, try to discard right.
-			if gn.rightDoor == model.Open {
-				discardPile = append(discardPile, discardable{i, model.Right})
-				nx = 0
-				if vx < minVelocity {
-					vx = minVelocity
-				}
-			} else {
-				if gn.leftDoor == model.Open {
-					discardPile = append(discardPile, discardable{i, model.Left})
-					nx = gn.scn.Width()
-				}
-				// Make ball go left.
-				if vx < minVelocity {
-					vx = -minVelocity
-				} else {
-					vx = -vx
-				}
-			}
+	discardPile := []physics.Exit{}
+	for _, b := range gn.world.Clear() {
+		d := gn.discardDirection(b.GetVel())
+		v := b.GetVel()
+		switch d {
+		case model.Left:
+			v.X = -atLeastMinSpeed(v.X)
+		case model.Right:
+			v.X = atLeastMinSpeed(v.X)
+		case model.Up:
+			v.Y = -atLeastMinSpeed(v.Y)
+		case model.Down:
+			v.Y = atLeastMinSpeed(v.Y)
 		}
-		if math.Abs(float64(vy)) < float64(minVelocity) {
+		if d.Horizontal() && math.Abs(float64(v.Y)) < minSpeed {
 			// Kick it up.
-			vy = -minVelocity
+			v.Y = -minSpeed
 		}
-		b.SetPos(nx, b.GetPos().Y)
-		b.SetVel(vx, vy)
+		b.SetVel(v.X, v.Y)
+		discardPile = append(discardPile, physics.Exit{b, d})
 	}
 
 	if gn.chatty {
@@ -606,15 +578,50 @@ func (gn *Engine) discardBalls() {
 		}
 	}
 	gn.throwBalls(discardPile)
-	gn.balls = []*model.Ball{}
+}
+
+// The open door a ball with velocity v heads most toward, or if none
+// is open, the direction it heads most toward.
+func (gn *Engine) discardDirection(v model.Vec) model.Direction {
+	toward := map[model.Direction]float32{
+		model.Left:  -v.X,
+		model.Right: v.X,
+		model.Up:    -v.Y,
+		model.Down:  v.Y,
+	}
+	best, found := model.Right, false
+	for _, d := range model.Directions {
+		isOpen := gn.world.Door(d) == model.Open
+		if isOpen && (!found || toward[d] > toward[best]) {
+			best, found = d, true
+		}
+	}
+	if found {
+		return best
+	}
+	for _, d := range model.Directions {
+		if toward[d] > toward[best] {
+			best = d
+		}
+	}
+	return best
+}
+
+func atLeastMinSpeed(f float32) float32 {
+	if f < 0 {
+		f = -f
+	}
+	if f < minSpeed {
+		return minSpeed
+	}
+	return f
 }
 
 func (gn *Engine) createBall() {
 	if gn.chatty {
 		log.Printf("Creating ball.")
 	}
-	gn.balls = append(
-		gn.balls,
+	gn.world.Add(
 		model.NewBall(
 			gn.nm.Me(),
 			model.Vec{gn.scn.Width() / 2, gn.scn.Height() / 2},
@@ -624,6 +631,64 @@ func (gn *Engine) createBall() {
 	}
 }
 
+// Move a newly arrived ball to where it would be had the throw been
+// instant, so slow networks show as a late start rather than a stall
+// at the edge.
+func (gn *Engine) catchUp(b *model.Ball) {
+	if b.SentAt().IsZero() {
+		return
+	}
+	flight := float32(time.Since(b.SentAt()).Seconds())
+	if flight <= 0 {
+		return
+	}
+	if flight > maxFlightTime {
+		flight = maxFlightTime
+	}
+	if gn.chatty {
+		log.Printf("Ball was in flight %.3fs.", flight)
+	}
+	gn.world.Coast(b, flight, stepDuration)
+}
+
+// What this player is up to, for the master.  Ball positions are
+// given as fractions of the screen, as on the wire.
+func (gn *Engine) state() model.State {
+	s := model.State{
+		Player:        gn.nm.Me(),
+		Doors:         gn.world.Doors(),
+		Gravity:       gn.world.Gravity() * stepDuration,
+		PauseDuration: gn.world.PauseDuration(),
+		Size:          gn.size,
+		Uptime:        time.Since(gn.started),
+		Version:       config.Version,
+	}
+	for _, b := range gn.world.Balls() {
+		p := b.GetPos()
+		if gn.scn.Width() > 0 && gn.scn.Height() > 0 {
+			p = model.Vec{p.X / gn.scn.Width(), p.Y / gn.scn.Height()}
+		}
+		s.Balls = append(s.Balls, model.NewBall(b.Owner(), p, b.GetVel()))
+	}
+	return s
+}
+
+// Width over height, or zero if the screen has no size yet.
+func (gn *Engine) aspect() float32 {
+	if gn.scn.Height() <= 0 {
+		return 0
+	}
+	return gn.scn.Width() / gn.scn.Height()
+}
+
+// Balls keep their place relative to the screen edges on a resize,
+// and take the same time to cross the screen regardless of its size.
+func (gn *Engine) resize(width float32, height float32) {
+	gn.scn.ReSize(width, height)
+	gn.world.SetSize(gn.scn.Width(), gn.scn.Height())
+	gn.resetImpulseLimit()
+}
+
 // Use fraction of characteristic screen size
 // to define max distance over which an impulse
 // is considered to have 'hit' a ball.
@@ -669,7 +734,7 @@ func (gn *Engine) closestDsq(im model.Vec) (
 	smallest float32, target *model.Ball) {
 	smallest = math.MaxFloat32
 	target = nil
-	for _, b := range gn.balls {
+	for _, b := range gn.world.Balls() {
 		dx := im.X - b.GetPos().X
 		dy := im.Y - b.GetPos().Y
 		dsq := dx*dx + dy*dy
@@ -685,17 +750,5 @@ func (gn *Engine) handleDoor(dc model.DoorCommand) {
 	if gn.chatty {
 		log.Printf("Received door command: %v", dc)
 	}
-	if dc.S == model.Open {
-		if dc.D == model.Left {
-			gn.leftDoor = model.Open
-		} else {
-			gn.rightDoor = model.Open
-		}
-	} else {
-		if dc.D == model.Left {
-			gn.leftDoor = model.Closed
-		} else {
-			gn.rightDoor = model.Closed
-		}
-	}
+	gn.world.SetDoor(dc)
 }
@@ -0,0 +1,258 @@
+package engine
+
+import (
+	"github.com/monopole/volley/model"
+	"testing"
+	"time"
+)
+
+// A screen that only remembers its size.
+type fakeScreen struct {
+	width  float32
+	height float32
+}
+
+func (s *fakeScreen) SetDrawContext(interface{}) error { return nil }
+func (s *fakeScreen) Start()                           {}
+func (s *fakeScreen) Clear()                           {}
+func (s *fakeScreen) Paint(balls []*model.Ball)        {}
+func (s *fakeScreen) Stop()                            {}
+func (s *fakeScreen) Width() float32                   { return s.width }
+func (s *fakeScreen) Height() float32                  { return s.height }
+
+func (s *fakeScreen) ReSize(width float32, height float32) {
+	s.width = width
+	s.height = height
+}
+
+// A net manager for a player alone in the room.
+type fakeNetManager struct{}
+
+func (nm *fakeNetManager) IsRunning() bool                                           { return true }
+func (nm *fakeNetManager) GetRelay() model.Relay                                     { return nil }
+func (nm *fakeNetManager) GetReady() <-chan bool                                     { return nil }
+func (nm *fakeNetManager) ChDoorCommand() <-chan model.DoorCommand                   { return nil }
+func (nm *fakeNetManager) ChPeerLost() <-chan *model.Player                          { return nil }
+func (nm *fakeNetManager) Me() *model.Player                                         { return model.NewPlayer(1) }
+func (nm *fakeNetManager) JoinGame(chBc <-chan model.BallCommand)                    {}
+func (nm *fakeNetManager) Refresh() error                                            { return nil }
+func (nm *fakeNetManager) Quit(id int) error                                         { return nil }
+func (nm *fakeNetManager) List(t model.Target) ([]*model.State, error)               { return nil, nil }
+func (nm *fakeNetManager) Poll() ([]*model.State, error)                             { return nil, nil }
+func (nm *fakeNetManager) FireBall(count int, t model.Target) (model.Results, error) { return nil, nil }
+func (nm *fakeNetManager) DoMasterCommand(c string, t model.Target) (model.Results, error) {
+	return nil, nil
+}
+func (nm *fakeNetManager) SetPauseDuration(pd float32, t model.Target) (model.Results, error) {
+	return nil, nil
+}
+func (nm *fakeNetManager) SetGravity(g float32, t model.Target) (model.Results, error) {
+	return nil, nil
+}
+func (nm *fakeNetManager) Room() model.Room              { return model.Room{} }
+func (nm *fakeNetManager) SetRoom(room model.Room) error { return nil }
+func (nm *fakeNetManager) Advertise(d model.Dimensions)  {}
+func (nm *fakeNetManager) ScreenSize(id int) (model.Dimensions, error) {
+	return model.Dimensions{}, nil
+}
+func (nm *fakeNetManager) NoNewBallsOrPeople() {}
+func (nm *fakeNetManager) Stop()               {}
+
+func makeTestEngine(width float32, height float32) *Engine {
+	gn := newEngine(false, &fakeNetManager{}, &fakeScreen{})
+	gn.resize(width, height)
+	return gn
+}
+
+func addBall(gn *Engine, x, y, dx, dy float32) *model.Ball {
+	b := model.NewBall(gn.nm.Me(), model.Vec{x, y}, model.Vec{dx, dy})
+	gn.world.Add(b)
+	return b
+}
+
+func near(a float32, b float32) bool {
+	d := a - b
+	return d > -0.001 && d < 0.001
+}
+
+func TestResizeKeepsRelativePosition(t *testing.T) {
+	gn := makeTestEngine(400, 200)
+	b := addBall(gn, 100, 150, 0.5, -0.25)
+	gn.resize(800, 100)
+	if p := b.GetPos(); !near(p.X, 200) || !near(p.Y, 75) {
+		t.Errorf("got pos %v, want {200, 75}", p.String())
+	}
+	if v := b.GetVel(); v.X != 0.5 || v.Y != -0.25 {
+		t.Errorf("velocity changed to %v", v.String())
+	}
+	if gn.world.Width() != 800 || gn.world.Height() != 100 {
+		t.Errorf("world is %.0fx%.0f, want 800x100",
+			gn.world.Width(), gn.world.Height())
+	}
+}
+
+func TestCrossingTimeIndependentOfSize(t *testing.T) {
+	crossingFraction := func(width, height float32) float32 {
+		gn := makeTestEngine(width, height)
+		b := addBall(gn, 0, height/2, 1, 0)
+		gn.world.Step(gn.world.PauseDuration() / 2)
+		return b.GetPos().X / gn.scn.Width()
+	}
+	small := crossingFraction(320, 480)
+	big := crossingFraction(2560, 1600)
+	if !near(small, 0.5) || !near(big, 0.5) {
+		t.Errorf("crossed %.3f of small and %.3f of big screen, want 0.5",
+			small, big)
+	}
+}
+
+func TestResizeAfterSteppingKeepsCrossingTime(t *testing.T) {
+	gn := makeTestEngine(300, 300)
+	b := addBall(gn, 0, 150, 1, 0)
+	pd := gn.world.PauseDuration()
+	gn.world.Step(pd / 4)
+	gn.resize(1200, 300)
+	gn.world.Step(pd / 4)
+	if x := b.GetPos().X / gn.scn.Width(); !near(x, 0.5) {
+		t.Errorf("ball is %.3f of the way across, want 0.5", x)
+	}
+}
+
+// Paint frames every frame apart from t0, and a last one at d.
+func runFrames(gn *Engine, t0 time.Time, frame, d time.Duration) {
+	gn.lastMove = t0
+	for at := frame; at < d; at += frame {
+		gn.moveBalls(t0.Add(at))
+	}
+	gn.moveBalls(t0.Add(d))
+}
+
+func TestCrossingTimeIndependentOfFrameRate(t *testing.T) {
+	crossingFraction := func(frame time.Duration) float32 {
+		gn := makeTestEngine(300, 300)
+		b := addBall(gn, 0, 150, 1, 0)
+		// Half a pause duration, and half a step to spare.
+		runFrames(gn, time.Now(), frame, 1508*time.Millisecond)
+		return b.GetPos().X / gn.scn.Width()
+	}
+	fast := crossingFraction(time.Second / 60)
+	slow := crossingFraction(time.Second / 25)
+	if !near(fast, 0.5) || !near(slow, 0.5) {
+		t.Errorf("crossed %.3f at 60fps and %.3f at 25fps, want 0.5",
+			fast, slow)
+	}
+}
+
+func TestStallIsCappedAtMaxLag(t *testing.T) {
+	gn := makeTestEngine(300, 300)
+	b := addBall(gn, 0, 150, 1, 0)
+	t0 := time.Now()
+	gn.lastMove = t0
+	gn.moveBalls(t0.Add(10 * time.Second))
+	speed := gn.scn.Width() / gn.world.PauseDuration()
+	if moved := b.GetPos().X / speed; moved > maxLag+0.001 ||
+		moved < maxLag-stepDuration-0.001 {
+		t.Errorf("moved for %.3fs, want about %.3fs", moved, maxLag)
+	}
+}
+
+func TestLagCarriesOverToNextFrame(t *testing.T) {
+	gn := makeTestEngine(300, 300)
+	b := addBall(gn, 0, 150, 1, 0)
+	step := time.Second / 60 // stepDuration
+	t0 := time.Now()
+	gn.lastMove = t0
+	gn.moveBalls(t0.Add(step * 3 / 2))
+	// Not a step on its own, but enough with what the last frame left.
+	gn.moveBalls(t0.Add(step * 21 / 10))
+	speed := gn.scn.Width() / gn.world.PauseDuration()
+	if moved := b.GetPos().X / speed; !near(moved, 2*stepDuration) {
+		t.Errorf("moved for %.4fs, want two steps of %.4fs",
+			moved, stepDuration)
+	}
+	if !near(gn.lag, stepDuration/10) {
+		t.Errorf("owed %.4fs, want %.4fs", gn.lag, stepDuration/10)
+	}
+}
+
+func TestResizeClampsBallsInside(t *testing.T) {
+	gn := makeTestEngine(0, 0)
+	// Arrived before the first size event, so has no sensible place.
+	b := addBall(gn, 500, -20, 0, 0)
+	gn.resize(300, 200)
+	if p := b.GetPos(); p.X != 300 || p.Y != 0 {
+		t.Errorf("got pos %v, want {300, 0}", p.String())
+	}
+}
+
+func TestStateGivesBallsAsFractions(t *testing.T) {
+	gn := makeTestEngine(400, 200)
+	addBall(gn, 100, 150, 0.5, -0.25)
+	gn.world.SetGravity(0.02 / stepDuration)
+	gn.handleDoor(model.WholeDoor(model.Open, model.Right))
+	s := gn.state()
+	if len(s.Balls) != 1 {
+		t.Fatalf("got %d balls, want 1", len(s.Balls))
+	}
+	if p := s.Balls[0].GetPos(); !near(p.X, 0.25) || !near(p.Y, 0.75) {
+		t.Errorf("got ball %v, want at {0.25, 0.75}", s.Balls[0])
+	}
+	if !near(s.Gravity, 0.02) {
+		t.Errorf("got gravity %.3f, want 0.02 as set", s.Gravity)
+	}
+	for _, dc := range s.Doors {
+		want := model.Closed
+		if dc.D == model.Right {
+			want = model.Open
+		}
+		if dc.S != want {
+			t.Errorf("got door %v, want %v", dc, want)
+		}
+	}
+}
+
+// Discard one ball with velocity {dx, dy} through the given open
+// doors, returning the direction it was thrown.
+func discardOne(doors []model.Direction, dx, dy float32) model.BallCommand {
+	gn := makeTestEngine(300, 300)
+	for _, d := range doors {
+		gn.world.SetDoor(model.WholeDoor(model.Open, d))
+	}
+	addBall(gn, 150, 150, dx, dy)
+	ch := make(chan model.BallCommand, 1)
+	go func() {
+		ch <- <-gn.chBallCommand
+	}()
+	gn.discardBalls()
+	return <-ch
+}
+
+func TestDiscardLeavesByOpenDoorBallHeadsMostToward(t *testing.T) {
+	cases := []struct {
+		doors  []model.Direction
+		dx, dy float32
+		want   model.Direction
+	}{
+		{[]model.Direction{model.Left, model.Up}, -0.2, -0.9, model.Up},
+		{[]model.Direction{model.Left, model.Up}, -0.9, -0.2, model.Left},
+		// Heading away from the only open door.
+		{[]model.Direction{model.Down}, -0.5, -0.1, model.Down},
+		{[]model.Direction{model.Right}, -0.5, 0.3, model.Right},
+		// No door, so it goes to the table.
+		{nil, 0.1, 0.7, model.Down},
+	}
+	for _, c := range cases {
+		bc := discardOne(c.doors, c.dx, c.dy)
+		if bc.D != c.want {
+			t.Errorf("ball going {%v, %v} through %v: thrown %v, want %v",
+				c.dx, c.dy, c.doors, bc.D, c.want)
+		}
+		v := bc.B.GetVel()
+		out := map[model.Direction]float32{
+			model.Left: -v.X, model.Right: v.X, model.Up: -v.Y, model.Down: v.Y}
+		if out[c.want] < minSpeed {
+			t.Errorf("ball thrown %v with velocity %v, heading back in",
+				c.want, v.String())
+		}
+	}
+}
@@ -29,12 +29,19 @@ func (MasterCommand) __VDLReflect(struct {
 }) {
 }
 
+// Ball velocity is dimensionless, relative to the size of the
+// sender's screen; Aspect is that screen's width over its height,
+// or zero if unknown.  SentAt is when the ball was thrown, in Unix
+// nanoseconds by the receiver's clock as estimated by the sender,
+// or zero if unknown.
 type Ball struct {
-	Owner Player
-	X     float32
-	Y     float32
-	Dx    float32
-	Dy    float32
+	Owner  Player
+	X      float32
+	Y      float32
+	Dx     float32
+	Dy     float32
+	Aspect float32
+	SentAt int64
 }
 
 func (Ball) __VDLReflect(struct {
@@ -42,10 +49,90 @@ func (Ball) __VDLReflect(struct {
 }) {
 }
 
+// Where a player's screen sits in the room, and its size, in
+// millimetres.
+type Slot struct {
+	Id int32
+	X  float32
+	Y  float32
+	W  float32
+	H  float32
+}
+
+func (Slot) __VDLReflect(struct {
+	Name string `vdl:"github.com/monopole/volley/ifc.Slot"`
+}) {
+}
+
+// How players are arranged: where their Slots say if there are any,
+// else a grid filled row by row in order of player id, Columns to a
+// row, or a single row if Columns is zero.  If Ring is true, the ends
+// of each row and column are joined.
+type Room struct {
+	Columns int32
+	Ring    bool
+	Slots   []Slot
+}
+
+func (Room) __VDLReflect(struct {
+	Name string `vdl:"github.com/monopole/volley/ifc.Room"`
+}) {
+}
+
+// Physical size of a player's screen in millimetres, or zeros if
+// unknown.
+type Size struct {
+	W float32
+	H float32
+}
+
+func (Size) __VDLReflect(struct {
+	Name string `vdl:"github.com/monopole/volley/ifc.Size"`
+}) {
+}
+
+// A door in the edge of a player's screen: its direction, as
+// model.Direction numbers them, whether it's open, and the span of
+// the edge it opens, as fractions of the edge's length.
+type Door struct {
+	Dir  int32
+	Open bool
+	Lo   float32
+	Hi   float32
+}
+
+func (Door) __VDLReflect(struct {
+	Name string `vdl:"github.com/monopole/volley/ifc.Door"`
+}) {
+}
+
+// What a player is up to.  Ball positions are fractions of the
+// screen's width and height.  Gravity and PauseDuration are as last
+// set by SetGravity and SetPauseDuration.  Uptime is in nanoseconds.
+type State struct {
+	Balls         []Ball
+	Doors         []Door
+	Gravity       float32
+	PauseDuration float32
+	Size          Size
+	Uptime        int64
+	Version       string
+}
+
+func (State) __VDLReflect(struct {
+	Name string `vdl:"github.com/monopole/volley/ifc.State"`
+}) {
+}
+
 func init() {
 	vdl.Register((*Player)(nil))
 	vdl.Register((*MasterCommand)(nil))
 	vdl.Register((*Ball)(nil))
+	vdl.Register((*Slot)(nil))
+	vdl.Register((*Room)(nil))
+	vdl.Register((*Size)(nil))
+	vdl.Register((*Door)(nil))
+	vdl.Register((*State)(nil))
 }
 
 // GameServiceClientMethods is the client interface
@@ -59,14 +146,32 @@ type GameServiceClientMethods interface {
 	Forget(ctx *context.T, p Player, opts ...rpc.CallOpt) error
 	// Accept a ball.
 	Accept(ctx *context.T, b Ball, opts ...rpc.CallOpt) error
+	// Receiver is the table, and keeps a ball nobody else could catch
+	// in play by dropping it in from the top of its screen.
+	Deposit(ctx *context.T, b Ball, opts ...rpc.CallOpt) error
 	// Quit
 	Quit(*context.T, ...rpc.CallOpt) error
+	// Returns the receiver's clock in Unix nanoseconds, so callers
+	// can estimate the offset between their clocks.
+	Now(*context.T, ...rpc.CallOpt) (int64, error)
+	// Returns at once, so neighbors can tell the receiver is alive.
+	Ping(*context.T, ...rpc.CallOpt) error
 	// Master command
 	DoMasterCommand(ctx *context.T, c MasterCommand, opts ...rpc.CallOpt) error
-	// Change value of pause duration.
+	// Change value of pause duration, the number of seconds a ball
+	// with unit velocity takes to cross a screen.
 	SetPauseDuration(ctx *context.T, p float32, opts ...rpc.CallOpt) error
-	// Change value of gravity
+	// Change value of gravity, the change in a ball's velocity
+	// per sixtieth of a second.
 	SetGravity(ctx *context.T, p float32, opts ...rpc.CallOpt) error
+	// Receiver rearranges its neighbors to suit the room.
+	SetRoom(ctx *context.T, r Room, opts ...rpc.CallOpt) error
+	// Returns the room as the receiver last heard it.
+	GetRoom(*context.T, ...rpc.CallOpt) (Room, error)
+	// Returns the physical size of the receiver's screen.
+	GetSize(*context.T, ...rpc.CallOpt) (Size, error)
+	// Returns what the receiver is up to right now.
+	GetState(*context.T, ...rpc.CallOpt) (State, error)
 }
 
 // GameServiceClientStub adds universal methods to GameServiceClientMethods.
@@ -99,11 +204,26 @@ func (c implGameServiceClientStub) Accept(ctx *context.T, i0 Ball, opts ...rpc.C
 	return
 }
 
+func (c implGameServiceClientStub) Deposit(ctx *context.T, i0 Ball, opts ...rpc.CallOpt) (err error) {
+	err = v23.GetClient(ctx).Call(ctx, c.name, "Deposit", []interface{}{i0}, nil, opts...)
+	return
+}
+
 func (c implGameServiceClientStub) Quit(ctx *context.T, opts ...rpc.CallOpt) (err error) {
 	err = v23.GetClient(ctx).Call(ctx, c.name, "Quit", nil, nil, opts...)
 	return
 }
 
+func (c implGameServiceClientStub) Now(ctx *context.T, opts ...rpc.CallOpt) (o0 int64, err error) {
+	err = v23.GetClient(ctx).Call(ctx, c.name, "Now", nil, []interface{}{&o0}, opts...)
+	return
+}
+
+func (c implGameServiceClientStub) Ping(ctx *context.T, opts ...rpc.CallOpt) (err error) {
+	err = v23.GetClient(ctx).Call(ctx, c.name, "Ping", nil, nil, opts...)
+	return
+}
+
 func (c implGameServiceClientStub) DoMasterCommand(ctx *context.T, i0 MasterCommand, opts ...rpc.CallOpt) (err error) {
 	err = v23.GetClient(ctx).Call(ctx, c.name, "DoMasterCommand", []interface{}{i0}, nil, opts...)
 	return
@@ -119,6 +239,26 @@ func (c implGameServiceClientStub) SetGravity(ctx *context.T, i0 float32, opts .
 	return
 }
 
+func (c implGameServiceClientStub) SetRoom(ctx *context.T, i0 Room, opts ...rpc.CallOpt) (err error) {
+	err = v23.GetClient(ctx).Call(ctx, c.name, "SetRoom", []interface{}{i0}, nil, opts...)
+	return
+}
+
+func (c implGameServiceClientStub) GetRoom(ctx *context.T, opts ...rpc.CallOpt) (o0 Room, err error) {
+	err = v23.GetClient(ctx).Call(ctx, c.name, "GetRoom", nil, []interface{}{&o0}, opts...)
+	return
+}
+
+func (c implGameServiceClientStub) GetSize(ctx *context.T, opts ...rpc.CallOpt) (o0 Size, err error) {
+	err = v23.GetClient(ctx).Call(ctx, c.name, "GetSize", nil, []interface{}{&o0}, opts...)
+	return
+}
+
+func (c implGameServiceClientStub) GetState(ctx *context.T, opts ...rpc.CallOpt) (o0 State, err error) {
+	err = v23.GetClient(ctx).Call(ctx, c.name, "GetState", nil, []interface{}{&o0}, opts...)
+	return
+}
+
 // GameServiceServerMethods is the interface a server writer
 // implements for GameService.
 type GameServiceServerMethods interface {
@@ -130,14 +270,32 @@ type GameServiceServerMethods interface {
 	Forget(ctx *context.T, call rpc.ServerCall, p Player) error
 	// Accept a ball.
 	Accept(ctx *context.T, call rpc.ServerCall, b Ball) error
+	// Receiver is the table, and keeps a ball nobody else could catch
+	// in play by dropping it in from the top of its screen.
+	Deposit(ctx *context.T, call rpc.ServerCall, b Ball) error
 	// Quit
 	Quit(*context.T, rpc.ServerCall) error
+	// Returns the receiver's clock in Unix nanoseconds, so callers
+	// can estimate the offset between their clocks.
+	Now(*context.T, rpc.ServerCall) (int64, error)
+	// Returns at once, so neighbors can tell the receiver is alive.
+	Ping(*context.T, rpc.ServerCall) error
 	// Master command
 	DoMasterCommand(ctx *context.T, call rpc.ServerCall, c MasterCommand) error
-	// Change value of pause duration.
+	// Change value of pause duration, the number of seconds a ball
+	// with unit velocity takes to cross a screen.
 	SetPauseDuration(ctx *context.T, call rpc.ServerCall, p float32) error
-	// Change value of gravity
+	// Change value of gravity, the change in a ball's velocity
+	// per sixtieth of a second.
 	SetGravity(ctx *context.T, call rpc.ServerCall, p float32) error
+	// Receiver rearranges its neighbors to suit the room.
+	SetRoom(ctx *context.T, call rpc.ServerCall, r Room) error
+	// Returns the room as the receiver last heard it.
+	GetRoom(*context.T, rpc.ServerCall) (Room, error)
+	// Returns the physical size of the receiver's screen.
+	GetSize(*context.T, rpc.ServerCall) (Size, error)
+	// Returns what the receiver is up to right now.
+	GetState(*context.T, rpc.ServerCall) (State, error)
 }
 
 // GameServiceServerStubMethods is the server interface containing
@@ -187,10 +345,22 @@ func (s implGameServiceServerStub) Accept(ctx *context.T, call rpc.ServerCall, i
 	return s.impl.Accept(ctx, call, i0)
 }
 
+func (s implGameServiceServerStub) Deposit(ctx *context.T, call rpc.ServerCall, i0 Ball) error {
+	return s.impl.Deposit(ctx, call, i0)
+}
+
 func (s implGameServiceServerStub) Quit(ctx *context.T, call rpc.ServerCall) error {
 	return s.impl.Quit(ctx, call)
 }
 
+func (s implGameServiceServerStub) Now(ctx *context.T, call rpc.ServerCall) (int64, error) {
+	return s.impl.Now(ctx, call)
+}
+
+func (s implGameServiceServerStub) Ping(ctx *context.T, call rpc.ServerCall) error {
+	return s.impl.Ping(ctx, call)
+}
+
 func (s implGameServiceServerStub) DoMasterCommand(ctx *context.T, call rpc.ServerCall, i0 MasterCommand) error {
 	return s.impl.DoMasterCommand(ctx, call, i0)
 }
@@ -203,6 +373,22 @@ func (s implGameServiceServerStub) SetGravity(ctx *context.T, call rpc.ServerCal
 	return s.impl.SetGravity(ctx, call, i0)
 }
 
+func (s implGameServiceServerStub) SetRoom(ctx *context.T, call rpc.ServerCall, i0 Room) error {
+	return s.impl.SetRoom(ctx, call, i0)
+}
+
+func (s implGameServiceServerStub) GetRoom(ctx *context.T, call rpc.ServerCall) (Room, error) {
+	return s.impl.GetRoom(ctx, call)
+}
+
+func (s implGameServiceServerStub) GetSize(ctx *context.T, call rpc.ServerCall) (Size, error) {
+	return s.impl.GetSize(ctx, call)
+}
+
+func (s implGameServiceServerStub) GetState(ctx *context.T, call rpc.ServerCall) (State, error) {
+	return s.impl.GetState(ctx, call)
+}
+
 func (s implGameServiceServerStub) Globber() *rpc.GlobState {
 	return s.gs
 }
@@ -240,10 +426,28 @@ var descGameService = rpc.InterfaceDesc{
 				{"b", ``}, // Ball
 			},
 		},
+		{
+			Name: "Deposit",
+			Doc:  "// Receiver is the table, and keeps a ball nobody else could catch\n// in play by dropping it in from the top of its screen.",
+			InArgs: []rpc.ArgDesc{
+				{"b", ``}, // Ball
+			},
+		},
 		{
 			Name: "Quit",
 			Doc:  "// Quit",
 		},
+		{
+			Name: "Now",
+			Doc:  "// Returns the receiver's clock in Unix nanoseconds, so callers\n// can estimate the offset between their clocks.",
+			OutArgs: []rpc.ArgDesc{
+				{"", ``}, // int64
+			},
+		},
+		{
+			Name: "Ping",
+			Doc:  "// Returns at once, so neighbors can tell the receiver is alive.",
+		},
 		{
 			Name: "DoMasterCommand",
 			Doc:  "// Master command",
@@ -253,17 +457,45 @@ var descGameService = rpc.InterfaceDesc{
 		},
 		{
 			Name: "SetPauseDuration",
-			Doc:  "// Change value of pause duration.",
+			Doc:  "// Change value of pause duration, the number of seconds a ball\n// with unit velocity takes to cross a screen.",
 			InArgs: []rpc.ArgDesc{
 				{"p", ``}, // float32
 			},
 		},
 		{
 			Name: "SetGravity",
-			Doc:  "// Change value of gravity",
+			Doc:  "// Change value of gravity, the change in a ball's velocity\n// per sixtieth of a second.",
 			InArgs: []rpc.ArgDesc{
 				{"p", ``}, // float32
 			},
 		},
+		{
+			Name: "SetRoom",
+			Doc:  "// Receiver rearranges its neighbors to suit the room.",
+			InArgs: []rpc.ArgDesc{
+				{"r", ``}, // Room
+			},
+		},
+		{
+			Name: "GetRoom",
+			Doc:  "// Returns the room as the receiver last heard it.",
+			OutArgs: []rpc.ArgDesc{
+				{"", ``}, // Room
+			},
+		},
+		{
+			Name: "GetSize",
+			Doc:  "// Returns the physical size of the receiver's screen.",
+			OutArgs: []rpc.ArgDesc{
+				{"", ``}, // Size
+			},
+		},
+		{
+			Name: "GetState",
+			Doc:  "// Returns what the receiver is up to right now.",
+			OutArgs: []rpc.ArgDesc{
+				{"", ``}, // State
+			},
+		},
 	},
 }
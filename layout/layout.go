@@ -0,0 +1,135 @@
+// Package layout edits, saves and loads the layout of a room.
+//
+// A layout is the set of slots in a model.Room; see package topology
+// for how slots decide who is next to whom.  Layouts are edited by the
+// master and kept as JSON files named for the layout, so a room set up
+// once can be set up again in one command.
+package layout
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/monopole/volley/config"
+	"github.com/monopole/volley/model"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Size given to a player placed without one, in millimetres; roughly
+// a phone lying on its side.
+const (
+	DefaultWidth  = 120
+	DefaultHeight = 65
+)
+
+// Copy of the room that shares no slots with it.
+func copyRoom(room model.Room) model.Room {
+	room.Slots = append([]model.Slot{}, room.Slots...)
+	return room
+}
+
+// Place puts the upper left corner of the given player's screen at
+// (x, y), keeping its size, or giving it the default size if the
+// player had no slot.
+func Place(room model.Room, id int, x, y float32) model.Room {
+	room = copyRoom(room)
+	for i := range room.Slots {
+		if room.Slots[i].Id == id {
+			room.Slots[i].X = x
+			room.Slots[i].Y = y
+			return room
+		}
+	}
+	room.Slots = append(room.Slots,
+		model.Slot{id, x, y, DefaultWidth, DefaultHeight})
+	return room
+}
+
+// Resize changes the size of the given player's screen, keeping its
+// upper left corner where it is.
+func Resize(room model.Room, id int, w, h float32) (model.Room, error) {
+	if w <= 0 || h <= 0 {
+		return room, fmt.Errorf("size %gx%g isn't positive", w, h)
+	}
+	room = copyRoom(room)
+	for i := range room.Slots {
+		if room.Slots[i].Id == id {
+			room.Slots[i].W = w
+			room.Slots[i].H = h
+			return room, nil
+		}
+	}
+	return room, fmt.Errorf("player %d has no slot", id)
+}
+
+// Order lines the given players up left to right, tops aligned,
+// keeping the sizes of those that have slots.  Other slots are left
+// alone.
+func Order(room model.Room, ids []int) model.Room {
+	var x float32
+	for _, id := range ids {
+		room = Place(room, id, x, 0)
+		s, _ := room.Slot(id)
+		x += s.W
+	}
+	return room
+}
+
+// Remove takes the given player out of the layout.
+func Remove(room model.Room, id int) model.Room {
+	slots := []model.Slot{}
+	for _, s := range room.Slots {
+		if s.Id != id {
+			slots = append(slots, s)
+		}
+	}
+	room.Slots = slots
+	return room
+}
+
+// Dir is where layouts are saved: config.LayoutDir under the home
+// directory.
+func Dir() string {
+	return filepath.Join(os.Getenv("HOME"), config.LayoutDir)
+}
+
+func fileName(dir, name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name[0] == '.' {
+		return "", fmt.Errorf("bad layout name %q", name)
+	}
+	return filepath.Join(dir, name+".json"), nil
+}
+
+// Save writes the room under the given name in dir, replacing any
+// layout of the same name.
+func Save(dir, name string, room model.Room) error {
+	fn, err := fileName(dir, name)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(room, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fn, data, 0644)
+}
+
+// Load reads the room saved under the given name in dir.
+func Load(dir, name string) (model.Room, error) {
+	var room model.Room
+	fn, err := fileName(dir, name)
+	if err != nil {
+		return room, err
+	}
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return room, err
+	}
+	err = json.Unmarshal(data, &room)
+	return room, err
+}
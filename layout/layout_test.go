@@ -0,0 +1,78 @@
+package layout
+
+import (
+	"github.com/monopole/volley/model"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestPlaceKeepsSize(t *testing.T) {
+	room := Place(model.Room{}, 3, 10, 20)
+	s, ok := room.Slot(3)
+	if !ok || s.W != DefaultWidth || s.H != DefaultHeight {
+		t.Fatalf("got slot %v, want default size", s)
+	}
+	room, err := Resize(room, 3, 200, 150)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	moved := Place(room, 3, 50, 0)
+	if s, _ := moved.Slot(3); s.X != 50 || s.Y != 0 || s.W != 200 || s.H != 150 {
+		t.Errorf("got slot %v", s)
+	}
+	// The original is untouched.
+	if s, _ := room.Slot(3); s.X != 10 {
+		t.Errorf("Place changed its argument: %v", s)
+	}
+	if _, err := Resize(room, 4, 10, 10); err == nil {
+		t.Errorf("resized a player without a slot")
+	}
+}
+
+func TestOrder(t *testing.T) {
+	room := Place(model.Room{}, 2, 500, 500)
+	room, _ = Resize(room, 2, 200, 150)
+	room = Order(room, []int{2, 7, 1})
+	want := []float32{0, 200, 200 + DefaultWidth}
+	for i, id := range []int{2, 7, 1} {
+		s, ok := room.Slot(id)
+		if !ok || s.X != want[i] || s.Y != 0 {
+			t.Errorf("got slot %v for %d, want x %.0f", s, id, want[i])
+		}
+	}
+	room = Remove(room, 7)
+	if _, ok := room.Slot(7); ok || len(room.Slots) != 2 {
+		t.Errorf("7 still in %v", room.Slots)
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	room := Order(model.Room{Ring: true}, []int{3, 1, 2})
+	if err := Save(dir, "table", room); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := Load(dir, "table")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !got.Ring || len(got.Slots) != 3 {
+		t.Fatalf("got %v, want %v", got, room)
+	}
+	for i := range room.Slots {
+		if got.Slots[i] != room.Slots[i] {
+			t.Errorf("got slot %v, want %v", got.Slots[i], room.Slots[i])
+		}
+	}
+	if _, err := Load(dir, "chairs"); err == nil {
+		t.Errorf("loaded a layout never saved")
+	}
+	if err := Save(dir, "../escape", room); err == nil {
+		t.Errorf("saved outside the layout directory")
+	}
+}
@@ -0,0 +1,259 @@
+// Package loopback connects players living in one process.
+//
+// A Hub stands in for both the mounttable and the network.  Each
+// manager made from a hub is a peer.Manager whose transport finds the
+// other players in the hub, and talks to them by calling their relays
+// directly instead of over RPCs.  Doors are decided just as they are
+// for networked players, so a test can run several engines or managers
+// side by side and watch them join, leave and throw balls.
+package loopback
+
+import (
+	"errors"
+	"github.com/monopole/volley/ifc"
+	"github.com/monopole/volley/peer"
+	"github.com/monopole/volley/relay"
+	"sort"
+	"sync"
+	"time"
+)
+
+// What a call to a player that has left the hub fails with.
+var errGone = errors.New("player has left")
+
+// What a ball dropped on the way fails with.
+var errDropped = errors.New("ball dropped on the way")
+
+// Hub holds all the players that can see each other.
+type Hub struct {
+	mu     sync.Mutex
+	relays map[int]*relay.Relay
+	lastId int
+	// Balls to drop on the way to each player, as a flaky network would.
+	drops map[int]int
+	// How late each player answers calls, as a slow network would.
+	delays map[int]time.Duration
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		relays: make(map[int]*relay.Relay),
+		drops:  make(map[int]int),
+		delays: make(map[int]time.Duration),
+	}
+}
+
+func (h *Hub) NewManager(chatty bool, isGameMaster bool) *peer.Manager {
+	return peer.NewManager(chatty, isGameMaster, &transport{h, 0})
+}
+
+// Register r under the next free id, returning the id and the ids of
+// the players already present.
+func (h *Hub) register(r *relay.Relay) (int, []int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	others := h.ids()
+	h.lastId++
+	h.relays[h.lastId] = r
+	return h.lastId, others
+}
+
+func (h *Hub) unregister(id int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.relays, id)
+}
+
+// Ids of registered players, sorted.
+func (h *Hub) Ids() []int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.ids()
+}
+
+func (h *Hub) ids() []int {
+	ids := []int{}
+	for id := range h.relays {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// Drop the next n balls thrown to the given player, though it's still
+// there.
+func (h *Hub) dropBalls(id int, n int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.drops[id] += n
+}
+
+// True if the next ball thrown to the given player is to be dropped.
+func (h *Hub) dropsBall(id int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.drops[id] == 0 {
+		return false
+	}
+	h.drops[id]--
+	return true
+}
+
+// Have the given player, which needn't have joined yet, answer every
+// call d late.
+func (h *Hub) slowDown(id int, d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.delays[id] = d
+}
+
+// Returns the relay of the given player, or nil if the player is gone,
+// and how late it answers.
+func (h *Hub) relayOf(id int) (*relay.Relay, time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.relays[id], h.delays[id]
+}
+
+// A peer.Transport through a hub.
+type transport struct {
+	hub  *Hub
+	myId int // Registered by Join.
+}
+
+func (t *transport) Open() error {
+	return nil
+}
+
+func (t *transport) List() ([]int, error) {
+	return t.hub.Ids(), nil
+}
+
+func (t *transport) Join(r *relay.Relay) (int, []int, error) {
+	id, others := t.hub.register(r)
+	t.myId = id
+	return id, others, nil
+}
+
+func (t *transport) Leave() error {
+	t.hub.unregister(t.myId)
+	return nil
+}
+
+func (t *transport) Dial(id int) peer.Peer {
+	return &loopPeer{t.hub, id}
+}
+
+func (t *transport) Close() {
+}
+
+// A player in the hub.  Calls fail with errGone once it has left.
+type loopPeer struct {
+	hub *Hub
+	id  int
+}
+
+func (p *loopPeer) call(f func(r *relay.Relay) error) error {
+	r, delay := p.hub.relayOf(p.id)
+	if r == nil {
+		return errGone
+	}
+	time.Sleep(delay)
+	return f(r)
+}
+
+func (p *loopPeer) Recognize(wp ifc.Player) error {
+	return p.call(func(r *relay.Relay) error {
+		return r.Recognize(nil, nil, wp)
+	})
+}
+
+func (p *loopPeer) Forget(wp ifc.Player) error {
+	return p.call(func(r *relay.Relay) error {
+		return r.Forget(nil, nil, wp)
+	})
+}
+
+func (p *loopPeer) Accept(b ifc.Ball) error {
+	if p.hub.dropsBall(p.id) {
+		return errDropped
+	}
+	return p.call(func(r *relay.Relay) error {
+		return r.Accept(nil, nil, b)
+	})
+}
+
+func (p *loopPeer) Deposit(b ifc.Ball) error {
+	return p.call(func(r *relay.Relay) error {
+		return r.Deposit(nil, nil, b)
+	})
+}
+
+func (p *loopPeer) Quit() error {
+	return p.call(func(r *relay.Relay) error {
+		return r.Quit(nil, nil)
+	})
+}
+
+func (p *loopPeer) Now() (then int64, err error) {
+	err = p.call(func(r *relay.Relay) (err error) {
+		then, err = r.Now(nil, nil)
+		return
+	})
+	return
+}
+
+// Answered at once, if at all, so wait doesn't matter.
+func (p *loopPeer) Ping(wait time.Duration) error {
+	return p.call(func(r *relay.Relay) error {
+		return r.Ping(nil, nil)
+	})
+}
+
+func (p *loopPeer) DoMasterCommand(mc ifc.MasterCommand) error {
+	return p.call(func(r *relay.Relay) error {
+		return r.DoMasterCommand(nil, nil, mc)
+	})
+}
+
+func (p *loopPeer) SetPauseDuration(pd float32) error {
+	return p.call(func(r *relay.Relay) error {
+		return r.SetPauseDuration(nil, nil, pd)
+	})
+}
+
+func (p *loopPeer) SetGravity(g float32) error {
+	return p.call(func(r *relay.Relay) error {
+		return r.SetGravity(nil, nil, g)
+	})
+}
+
+func (p *loopPeer) SetRoom(wr ifc.Room) error {
+	return p.call(func(r *relay.Relay) error {
+		return r.SetRoom(nil, nil, wr)
+	})
+}
+
+func (p *loopPeer) GetRoom() (wr ifc.Room, err error) {
+	err = p.call(func(r *relay.Relay) (err error) {
+		wr, err = r.GetRoom(nil, nil)
+		return
+	})
+	return
+}
+
+func (p *loopPeer) GetSize() (ws ifc.Size, err error) {
+	err = p.call(func(r *relay.Relay) (err error) {
+		ws, err = r.GetSize(nil, nil)
+		return
+	})
+	return
+}
+
+func (p *loopPeer) GetState() (ws ifc.State, err error) {
+	err = p.call(func(r *relay.Relay) (err error) {
+		ws, err = r.GetState(nil, nil)
+		return
+	})
+	return
+}
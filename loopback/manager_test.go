@@ -0,0 +1,615 @@
+package loopback
+
+import (
+	"github.com/monopole/volley/config"
+	"github.com/monopole/volley/layout"
+	"github.com/monopole/volley/model"
+	"github.com/monopole/volley/peer"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A player as seen by a test: a manager, plus the door states its
+// engine would have been told about.
+type testPlayer struct {
+	nm    *peer.Manager
+	chBc  chan model.BallCommand
+	mu    sync.Mutex
+	doors map[model.Direction]model.DoorCommand
+}
+
+func join(t *testing.T, h *Hub) *testPlayer {
+	tp := &testPlayer{
+		nm:    h.NewManager(false, false),
+		chBc:  make(chan model.BallCommand),
+		doors: model.ClosedDoors(),
+	}
+	tp.nm.SetPingInterval(10 * time.Millisecond)
+	if !<-tp.nm.GetReady() {
+		t.Fatalf("manager not ready")
+	}
+	go func() {
+		for dc := range tp.nm.ChDoorCommand() {
+			tp.mu.Lock()
+			tp.doors[dc.D] = dc
+			tp.mu.Unlock()
+		}
+	}()
+	tp.nm.JoinGame(tp.chBc)
+	return tp
+}
+
+func (tp *testPlayer) leave() {
+	tp.nm.NoNewBallsOrPeople()
+	tp.nm.Stop()
+}
+
+func (tp *testPlayer) door(d model.Direction) model.DoorState {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	return tp.doors[d].S
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func expectDoors(
+	t *testing.T, tp *testPlayer, left model.DoorState, right model.DoorState) {
+	waitFor(t, "doors of "+tp.nm.Me().String(), func() bool {
+		return tp.door(model.Left) == left && tp.door(model.Right) == right
+	})
+}
+
+func TestJoinOpensDoorsBetweenNeighbors(t *testing.T) {
+	h := NewHub()
+	p1 := join(t, h)
+	expectDoors(t, p1, model.Closed, model.Closed)
+	p2 := join(t, h)
+	p3 := join(t, h)
+	expectDoors(t, p1, model.Closed, model.Open)
+	expectDoors(t, p2, model.Open, model.Open)
+	expectDoors(t, p3, model.Open, model.Closed)
+	if p1.nm.Me().Id() >= p2.nm.Me().Id() || p2.nm.Me().Id() >= p3.nm.Me().Id() {
+		t.Errorf("ids not increasing: %v %v %v",
+			p1.nm.Me(), p2.nm.Me(), p3.nm.Me())
+	}
+}
+
+func TestLeavingClosesDoors(t *testing.T) {
+	h := NewHub()
+	p1 := join(t, h)
+	p2 := join(t, h)
+	p3 := join(t, h)
+	expectDoors(t, p2, model.Open, model.Open)
+
+	p2.leave()
+	expectDoors(t, p1, model.Closed, model.Open)
+	expectDoors(t, p3, model.Open, model.Closed)
+
+	p3.leave()
+	expectDoors(t, p1, model.Closed, model.Closed)
+	if ids := h.Ids(); len(ids) != 1 || ids[0] != p1.nm.Me().Id() {
+		t.Errorf("hub holds %v, want just %v", ids, p1.nm.Me())
+	}
+}
+
+func receive(t *testing.T, tp *testPlayer) *model.Ball {
+	select {
+	case b := <-tp.nm.GetRelay().ChIncomingBall():
+		return b
+	case <-time.After(2 * time.Second):
+		t.Fatalf("player %v got no ball", tp.nm.Me())
+	}
+	return nil
+}
+
+func TestBallHandoff(t *testing.T) {
+	h := NewHub()
+	p1 := join(t, h)
+	p2 := join(t, h)
+	p3 := join(t, h)
+	expectDoors(t, p2, model.Open, model.Open)
+
+	b := model.NewBall(p1.nm.Me(), model.Vec{0, 0.25}, model.Vec{1, -0.5})
+	p2.chBc <- model.BallCommand{b, model.Right}
+	got := receive(t, p3)
+	if got.Owner().Id() != p1.nm.Me().Id() {
+		t.Errorf("got owner %v, want %v", got.Owner(), p1.nm.Me())
+	}
+	if got.GetPos().Y != 0.25 || got.GetVel().X != 1 || got.GetVel().Y != -0.5 {
+		t.Errorf("ball changed in flight: %v", got)
+	}
+
+	p2.chBc <- model.BallCommand{b, model.Left}
+	receive(t, p1)
+}
+
+func TestMasterReachesEveryone(t *testing.T) {
+	h := NewHub()
+	players := []*testPlayer{join(t, h), join(t, h), join(t, h)}
+	master := h.NewManager(false, true)
+	<-master.GetReady()
+	master.JoinGame(nil)
+
+	master.SetGravity(0.5, model.Everyone)
+	for _, tp := range players {
+		select {
+		case g := <-tp.nm.GetRelay().ChGravity():
+			if g != 0.5 {
+				t.Errorf("player %v got gravity %.2f", tp.nm.Me(), g)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("player %v got no gravity", tp.nm.Me())
+		}
+	}
+	master.FireBall(1, model.Everyone)
+	for _, tp := range players {
+		receive(t, tp)
+	}
+	if len(h.Ids()) != len(players) {
+		t.Errorf("master should not be registered as a player")
+	}
+}
+
+func TestMasterReachesOnlyTargets(t *testing.T) {
+	h := NewHub()
+	players := []*testPlayer{join(t, h), join(t, h), join(t, h)}
+	master := h.NewManager(false, true)
+	<-master.GetReady()
+	master.JoinGame(nil)
+
+	id := players[1].nm.Me().Id()
+	rs, err := master.SetGravity(0.5, model.Target{Ids: []int{id, 99}})
+	if len(rs) != 2 || rs[0].Player.Id() != id || rs[0].Err != nil ||
+		rs[1].Player.Id() != 99 || rs[1].Err == nil {
+		t.Errorf("got results %v, want player %d ok and 99 failed", rs, id)
+	}
+	if errs, ok := err.(model.PeerErrors); !ok || len(errs) != 1 {
+		t.Errorf("got error %v, want one failure", err)
+	}
+	<-players[1].nm.GetRelay().ChGravity()
+	for _, tp := range []*testPlayer{players[0], players[2]} {
+		select {
+		case <-tp.nm.GetRelay().ChGravity():
+			t.Errorf("player %v wasn't picked, yet got gravity", tp.nm.Me())
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+func TestMasterCommandReachesHalfTheRoom(t *testing.T) {
+	h := NewHub()
+	players := []*testPlayer{join(t, h), join(t, h), join(t, h)}
+	master := h.NewManager(false, true)
+	<-master.GetReady()
+	master.JoinGame(nil)
+
+	// In a row of three, the one in the middle is in neither half.
+	rs, err := master.DoMasterCommand(
+		"kick", model.Target{Half: model.LeftHalf})
+	want := []int{players[0].nm.Me().Id()}
+	if got := calledIds(rs); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("called %v with error %v, want %v", got, err, want)
+	}
+	select {
+	case mc := <-players[0].nm.GetRelay().ChMasterCommand():
+		if mc.Name != "kick" {
+			t.Errorf("got command %v, want kick", mc)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("player %v got no command", players[0].nm.Me())
+	}
+	// The master picks, so the others hear nothing.
+	for _, tp := range players[1:] {
+		select {
+		case mc := <-tp.nm.GetRelay().ChMasterCommand():
+			t.Errorf("player %v isn't on the left, yet got %v", tp.nm.Me(), mc)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// The ids of the players called, in order.
+func calledIds(rs model.Results) []int {
+	ids := []int{}
+	for _, r := range rs {
+		ids = append(ids, r.Player.Id())
+	}
+	return ids
+}
+
+func TestMasterRefreshSeesComingsAndGoings(t *testing.T) {
+	h := NewHub()
+	p1 := join(t, h)
+	master := h.NewManager(false, true)
+	<-master.GetReady()
+	master.JoinGame(nil)
+	p2 := join(t, h)
+
+	if err := master.Refresh(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rs, _ := master.SetGravity(0.5, model.Everyone)
+	want := []int{p1.nm.Me().Id(), p2.nm.Me().Id()}
+	if got := calledIds(rs); !reflect.DeepEqual(got, want) {
+		t.Errorf("called %v, want %v", got, want)
+	}
+	p1.leave()
+	if err := master.Refresh(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rs, err := master.SetGravity(0.5, model.Everyone)
+	want = []int{p2.nm.Me().Id()}
+	if got := calledIds(rs); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("called %v with error %v, want %v", got, err, want)
+	}
+}
+
+func TestMasterListsStates(t *testing.T) {
+	h := NewHub()
+	players := []*testPlayer{join(t, h), join(t, h)}
+	for _, tp := range players {
+		// Answer for the engine, just once.
+		go func(tp *testPlayer) {
+			ch := <-tp.nm.GetRelay().ChState()
+			b := model.NewBall(tp.nm.Me(), model.Vec{0.5, 0.25}, model.Vec{1, 0})
+			ch <- model.State{Balls: []*model.Ball{b}, Version: "test"}
+		}(tp)
+	}
+	master := h.NewManager(false, true)
+	<-master.GetReady()
+	master.JoinGame(nil)
+
+	states, err := master.List(model.Everyone)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(states) != len(players) {
+		t.Fatalf("got %d states, want %d", len(states), len(players))
+	}
+	for i, s := range states {
+		if s.Player.Id() != players[i].nm.Me().Id() {
+			t.Errorf("state %d is of %v, want %v", i, s.Player, players[i].nm.Me())
+		}
+		if s.Version != "test" || len(s.Balls) != 1 ||
+			s.Balls[0].GetPos().Y != 0.25 {
+			t.Errorf("got state %v, want the one sent", s)
+		}
+	}
+}
+
+func TestMasterPollKeepsPlayersThatDoNotSay(t *testing.T) {
+	h := NewHub()
+	p1 := join(t, h)
+	master := h.NewManager(false, true)
+	<-master.GetReady()
+	master.JoinGame(nil)
+
+	// No engine answers for p1, as before it starts.
+	states, err := master.Poll()
+	if err != nil || len(states) != 0 {
+		t.Errorf("got %v, %v; want no states", states, err)
+	}
+	rs, _ := master.SetGravity(0.5, model.Everyone)
+	want := []int{p1.nm.Me().Id()}
+	if got := calledIds(rs); !reflect.DeepEqual(got, want) {
+		t.Errorf("called %v, want %v still in the room", got, want)
+	}
+}
+
+// A player that vanishes without saying goodbye, as if its device died.
+func (tp *testPlayer) crash(h *Hub) {
+	h.unregister(tp.nm.Me().Id())
+}
+
+func TestBallToCrashedPlayerBouncesBack(t *testing.T) {
+	h := NewHub()
+	p1 := join(t, h)
+	p2 := join(t, h)
+	expectDoors(t, p1, model.Closed, model.Open)
+	p2.crash(h)
+
+	// Thrown right, so enters the neighbor from its left.
+	b := model.NewBall(p1.nm.Me(), model.Vec{0, 0.25}, model.Vec{1, -0.5})
+	p1.chBc <- model.BallCommand{b, model.Right}
+	got := receive(t, p1)
+	if got.GetPos().X != 1 || got.GetPos().Y != 0.25 {
+		t.Errorf("ball should come back at the right edge, got %v", got)
+	}
+	if got.GetVel().X != -1 || got.GetVel().Y != -0.5 {
+		t.Errorf("ball should head back left, got %v", got)
+	}
+	expectDoors(t, p1, model.Closed, model.Closed)
+}
+
+func TestBroadcastReportsAndEvictsCrashedPlayers(t *testing.T) {
+	h := NewHub()
+	p1 := join(t, h)
+	p2 := join(t, h)
+	expectDoors(t, p1, model.Closed, model.Open)
+	master := h.NewManager(false, true)
+	<-master.GetReady()
+	master.JoinGame(nil)
+	p2.crash(h)
+
+	rs, err := master.SetGravity(0.5, model.Everyone)
+	errs, ok := err.(model.PeerErrors)
+	if !ok || len(errs) != 1 || errs[0].Player.Id() != p2.nm.Me().Id() {
+		t.Fatalf("got error %v, want one failure for %v", err, p2.nm.Me())
+	}
+	if len(rs) != 2 || rs[0].Player.Id() != p1.nm.Me().Id() ||
+		rs[0].Err != nil || rs[1].Err == nil {
+		t.Errorf("got results %v, want %v ok and %v failed",
+			rs, p1.nm.Me(), p2.nm.Me())
+	}
+	<-p1.nm.GetRelay().ChGravity()
+	if _, err := master.SetGravity(0.25, model.Everyone); err != nil {
+		t.Errorf("crashed player should have been evicted, got %v", err)
+	}
+	<-p1.nm.GetRelay().ChGravity()
+}
+
+func TestSilentPlayerIsForgotten(t *testing.T) {
+	h := NewHub()
+	p1 := join(t, h)
+	p2 := join(t, h)
+	p3 := join(t, h)
+	expectDoors(t, p2, model.Open, model.Open)
+	p2.crash(h)
+
+	select {
+	case p := <-p1.nm.ChPeerLost():
+		if p.Id() != p2.nm.Me().Id() {
+			t.Errorf("lost %v, want %v", p, p2.nm.Me())
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("never noticed %v stopped answering", p2.nm.Me())
+	}
+	// Now neighbors, whoever noticed first.
+	expectDoors(t, p1, model.Closed, model.Open)
+	expectDoors(t, p3, model.Open, model.Closed)
+	b := model.NewBall(p1.nm.Me(), model.Vec{0, 0.5}, model.Vec{1, 0})
+	p1.chBc <- model.BallCommand{b, model.Right}
+	receive(t, p3)
+}
+
+func TestDroppedPlayerComesBack(t *testing.T) {
+	h := NewHub()
+	p1 := join(t, h)
+	p2 := join(t, h)
+	expectDoors(t, p1, model.Closed, model.Open)
+	h.dropBalls(p2.nm.Me().Id(), 1)
+
+	// The throw fails once, so p1 drops p2, though p2 is fine and
+	// still sees p1 as its neighbor.
+	b := model.NewBall(p1.nm.Me(), model.Vec{0, 0.5}, model.Vec{1, 0})
+	p1.chBc <- model.BallCommand{b, model.Right}
+	receive(t, p1)
+	select {
+	case p := <-p1.nm.ChPeerLost():
+		if p.Id() != p2.nm.Me().Id() {
+			t.Errorf("lost %v, want %v", p, p2.nm.Me())
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("%v wasn't dropped", p2.nm.Me())
+	}
+	expectDoors(t, p1, model.Closed, model.Closed)
+	// p1 finds p2 again, and throws to it.
+	expectDoors(t, p1, model.Closed, model.Open)
+	p1.chBc <- model.BallCommand{b, model.Right}
+	receive(t, p2)
+}
+
+func TestSlowJoinerDoesNotHoldUpBalls(t *testing.T) {
+	h := NewHub()
+	p1 := join(t, h)
+	p2 := join(t, h)
+	expectDoors(t, p1, model.Closed, model.Open)
+	// The next to join answers a second late, so reading its clock
+	// takes seconds.
+	h.slowDown(p2.nm.Me().Id()+1, time.Second)
+	join(t, h)
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	b := model.NewBall(p1.nm.Me(), model.Vec{0, 0.5}, model.Vec{1, 0})
+	p1.chBc <- model.BallCommand{b, model.Right}
+	receive(t, p2)
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("ball took %v, held up by the slow joiner", d)
+	}
+}
+
+func expectDeposit(t *testing.T, tp *testPlayer) {
+	if got := receive(t, tp); got.GetPos().X != config.MagicX {
+		t.Errorf("ball should drop in from the top, got %v", got)
+	}
+}
+
+func TestLeavingTableHandsBallsOn(t *testing.T) {
+	h := NewHub()
+	p1 := join(t, h)
+	p2 := join(t, h)
+	expectDoors(t, p1, model.Closed, model.Open)
+	// p1 is the table, but is quitting, with a ball headed for a wall.
+	p1.nm.NoNewBallsOrPeople()
+	b := model.NewBall(p1.nm.Me(), model.Vec{0, 0.5}, model.Vec{-1, 0})
+	p1.chBc <- model.BallCommand{b, model.Left}
+	expectDeposit(t, p2)
+}
+
+func TestOrphanedBallGoesToTable(t *testing.T) {
+	h := NewHub()
+	p1 := join(t, h)
+	p2 := join(t, h)
+	p3 := join(t, h)
+	expectDoors(t, p3, model.Open, model.Closed)
+
+	// Nobody to the right of the last player.
+	b := model.NewBall(p3.nm.Me(), model.Vec{0, 0.5}, model.Vec{1, 0})
+	p3.chBc <- model.BallCommand{b, model.Right}
+	expectDeposit(t, p1)
+
+	// With the table gone, the next lowest takes over.
+	p1.crash(h)
+	p3.chBc <- model.BallCommand{b, model.Right}
+	expectDeposit(t, p2)
+
+	// Nobody lower than the table, so it keeps the ball itself.
+	expectDoors(t, p2, model.Closed, model.Open)
+	p2.chBc <- model.BallCommand{b, model.Left}
+	expectDeposit(t, p2)
+}
+
+func expectDoor(
+	t *testing.T, tp *testPlayer, d model.Direction, s model.DoorState) {
+	waitFor(t, d.String()+" door of "+tp.nm.Me().String(), func() bool {
+		return tp.door(d) == s
+	})
+}
+
+// Four players in rows of two, and a fifth joining later:
+//
+//	1 2
+//	3 4
+//	5
+func TestGridRoom(t *testing.T) {
+	h := NewHub()
+	p1 := join(t, h)
+	p2 := join(t, h)
+	p3 := join(t, h)
+	p4 := join(t, h)
+	master := h.NewManager(false, true)
+	<-master.GetReady()
+	master.JoinGame(nil)
+	if err := master.SetRoom(model.Room{Columns: 2}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectDoor(t, p1, model.Down, model.Open)
+	expectDoor(t, p2, model.Left, model.Open)
+	expectDoor(t, p3, model.Up, model.Open)
+	expectDoor(t, p4, model.Up, model.Open)
+	expectDoors(t, p3, model.Closed, model.Open)
+	expectDoors(t, p2, model.Open, model.Closed)
+
+	b := model.NewBall(p1.nm.Me(), model.Vec{0.5, 0}, model.Vec{0, 1})
+	p1.chBc <- model.BallCommand{b, model.Down}
+	receive(t, p3)
+
+	p5 := join(t, h)
+	expectDoor(t, p5, model.Up, model.Open)
+	expectDoors(t, p5, model.Closed, model.Closed)
+	expectDoor(t, p3, model.Down, model.Open)
+	expectDoor(t, p4, model.Down, model.Closed)
+}
+
+func TestRingJoinsEnds(t *testing.T) {
+	h := NewHub()
+	p1 := join(t, h)
+	join(t, h)
+	p3 := join(t, h)
+	master := h.NewManager(false, true)
+	<-master.GetReady()
+	master.JoinGame(nil)
+
+	room := master.Room()
+	room.Ring = true
+	if err := master.SetRoom(room); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectDoors(t, p1, model.Open, model.Open)
+	expectDoors(t, p3, model.Open, model.Open)
+	b := model.NewBall(p3.nm.Me(), model.Vec{1, 0.5}, model.Vec{1, 0})
+	p3.chBc <- model.BallCommand{b, model.Right}
+	receive(t, p1)
+
+	room.Ring = false
+	master.SetRoom(room)
+	expectDoors(t, p1, model.Closed, model.Open)
+	expectDoors(t, p3, model.Open, model.Closed)
+}
+
+func TestDoorsFollowLayout(t *testing.T) {
+	h := NewHub()
+	p1 := join(t, h)
+	p2 := join(t, h)
+	p3 := join(t, h)
+	master := h.NewManager(false, true)
+	<-master.GetReady()
+	master.JoinGame(nil)
+
+	// Player 3 sits on the left, ahead of those that launched first.
+	ids := []int{p3.nm.Me().Id(), p1.nm.Me().Id(), p2.nm.Me().Id()}
+	if err := master.SetRoom(layout.Order(master.Room(), ids)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectDoors(t, p3, model.Closed, model.Open)
+	expectDoors(t, p1, model.Open, model.Open)
+	expectDoors(t, p2, model.Open, model.Closed)
+	b := model.NewBall(p1.nm.Me(), model.Vec{0, 0.5}, model.Vec{-1, 0})
+	p1.chBc <- model.BallCommand{b, model.Left}
+	receive(t, p3)
+}
+
+// A phone standing beside the lower half of a tablet, each sized by
+// what it advertises:
+//
+//	+-------+
+//	|   1   |
+//	|       | +---+
+//	|       | | 2 |
+//	+-------+ +---+
+func TestBallKeepsPlaceInRoom(t *testing.T) {
+	h := NewHub()
+	p1 := join(t, h)
+	p2 := join(t, h)
+	p1.nm.Advertise(model.Dimensions{200, 160})
+	p2.nm.Advertise(model.Dimensions{60, 80})
+	master := h.NewManager(false, true)
+	<-master.GetReady()
+	master.JoinGame(nil)
+
+	room := master.Room()
+	for _, tp := range []*testPlayer{p1, p2} {
+		d, err := master.ScreenSize(tp.nm.Me().Id())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		room = layout.Place(room, tp.nm.Me().Id(), 0, 0)
+		if room, err = layout.Resize(room, tp.nm.Me().Id(), d.W, d.H); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	room = layout.Place(room, p2.nm.Me().Id(), 200, 80)
+	if err := master.SetRoom(room); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitFor(t, "part door", func() bool {
+		p1.mu.Lock()
+		defer p1.mu.Unlock()
+		return p1.doors[model.Right].Lo == 0.5
+	})
+
+	b := model.NewBall(p1.nm.Me(), model.Vec{0, 0.75}, model.Vec{0.25, 0.5})
+	b.SetAspect(1.25)
+	p1.chBc <- model.BallCommand{b, model.Right}
+	got := receive(t, p2)
+	if got.GetPos().X != 0 || got.GetPos().Y != 0.5 {
+		t.Errorf("got %v, want it half way down the left edge", got)
+	}
+	if got.GetVel().X != 50.0/60 || got.GetVel().Y != 1 {
+		t.Errorf("got %v, want velocity {0.83, 1}", got)
+	}
+	if got.Aspect() != 0 {
+		t.Errorf("got aspect %v; velocity is already fitted", got.Aspect())
+	}
+}
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/monopole/volley/model"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Exit codes, for scripts.
+const (
+	exitOk     = 0
+	exitFailed = 1 // The game couldn't be reached, or a call failed.
+	exitUsage  = 2 // The command line made no sense.
+)
+
+// What the engine does on a DoMasterCommand.
+var masterCommands = []string{"kick", "left", "right", "random", "destroy"}
+
+// A master that has joined the game, with somewhere to print.
+type session struct {
+	nm   model.NetManager
+	out  io.Writer
+	host bool // Hosts the namespace.
+}
+
+// Print how each call went, if any were made, returning err.
+func (s *session) report(rs model.Results, err error) error {
+	if rs != nil {
+		printResults(s.out, rs)
+	}
+	return err
+}
+
+// What a command does once the master has joined the game.  A command
+// with a nil action has done all it needs to without joining.
+type action func(s *session) error
+
+// A subcommand of the master.  Flags and arguments are checked before
+// the master joins the game, so a mistyped command fails at once,
+// without reaching any player.
+type command struct {
+	name string
+	args string // Synopsis of the arguments.
+	help string // The first line is a summary.
+	// Define the flags on fs, and parse them and the arguments.
+	parse func(fs *flag.FlagSet, args []string) (action, error)
+}
+
+func (c *command) summary() string {
+	return strings.SplitN(c.help, "\n", 2)[0]
+}
+
+func (c *command) flagSet(out io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	fs.SetOutput(out)
+	fs.Usage = func() {
+		fmt.Fprintf(out, "usage: master %s %s\n\n%s\n", c.name, c.args, c.help)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"list", "[-json] [-p players]",
+			"Show what each player is up to.", parseList},
+		{"fire", "[-p players] [count]",
+			"Drop count balls, one by default, in on each player.", parseFire},
+		{"mc", "[-p players] <" + strings.Join(masterCommands, "|") + ">",
+			"Move or destroy each player's balls.\n" +
+				"kick stops them, left, right and random send them that way,\n" +
+				"and destroy removes them.", parseMc},
+		{"quit", "<id> ...", "Stop the given players.", parseQuit},
+		{"gravity", "[-p players] <g>",
+			"Set gravity, as the change in speed per step.\n" +
+				"Give -- before a negative g.", parseGravity},
+		{"pause", "[-p players] <duration>",
+			"Set how long a ball takes to cross a screen.", parsePause},
+		{"grid", "<columns>",
+			"Stand players in rows.\n" +
+				"Zero columns puts everyone back in a single row.", parseGrid},
+		{"ring", "<on|off>",
+			"Join the ends of the row, or of each row and column.", parseRing},
+		{"layout", "<subcommand> [args]",
+			"Show or change where each screen stands.\n\n" + layoutUsage,
+			parseLayout},
+		{"console", "[-every duration]",
+			"Stay in the game, showing the room live, and take commands.\n\n" +
+				consoleUsage, parseConsole},
+		{"run", "[-dry-run] <script>",
+			"Run a script of commands, each in its time.\n\n" + scriptUsage,
+			parseRun},
+		{"serve", "[-addr host:port] [-every duration]",
+			"Serve a web page showing the room live, with controls for\n" +
+				"fire, mc, gravity and pause, which post to /fire, /mc,\n" +
+				"/gravity and /pause the parameters count, name, g and\n" +
+				"duration, and p, as on the command line.", parseServe},
+		{"host", "",
+			"Just host the namespace, given -host-ns, until interrupted.",
+			parseHost},
+		{"help", "[command]", "Show help on a command.", parseHelp},
+	}
+}
+
+func findCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// Print how to run the master, with the global flags.
+func usage() {
+	out := os.Stderr
+	fmt.Fprintf(out, "usage: master [flags] <command> [command flags] [args]\n\n")
+	fmt.Fprintf(out, "Commands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-8s %s\n", c.name, c.summary())
+	}
+	fmt.Fprintf(out, "\nRun 'master help <command>' for more.  "+
+		"Exit status is %d on success,\n%d if the game couldn't be reached "+
+		"or a call to a player failed,\nand %d given a bad command line.\n\n",
+		exitOk, exitFailed, exitUsage)
+	fmt.Fprintf(out, "Flags:\n")
+	flag.PrintDefaults()
+}
+
+// Find and parse the command given by args, printing complaints to
+// errOut.  Asking for help gives flag.ErrHelp.
+func parse(args []string, errOut io.Writer) (*command, action, error) {
+	if len(args) == 0 {
+		fmt.Fprintln(errOut, "master: no command given.")
+		fmt.Fprintln(errOut, "Run 'master help' for usage.")
+		return nil, nil, usagef("no command")
+	}
+	c := findCommand(args[0])
+	if c == nil {
+		fmt.Fprintf(errOut, "master: unknown command %q.\n", args[0])
+		fmt.Fprintln(errOut, "Run 'master help' for usage.")
+		return nil, nil, usagef("unknown command %q", args[0])
+	}
+	fs := c.flagSet(errOut)
+	act, err := c.parse(fs, args[1:])
+	if ue, ok := err.(*usageError); ok {
+		fmt.Fprintf(errOut, "master %s: %v\n", c.name, ue)
+		fs.Usage()
+	}
+	return c, act, err
+}
+
+// An error in how a command was given, rather than in carrying it out.
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+func usagef(format string, a ...interface{}) error {
+	return &usageError{fmt.Sprintf(format, a...)}
+}
+
+// Player ids, as given to quit.
+type idsFlag []int
+
+func (f *idsFlag) String() string {
+	s := make([]string, len(*f))
+	for i, id := range *f {
+		s[i] = strconv.Itoa(id)
+	}
+	return strings.Join(s, ",")
+}
+
+func (f *idsFlag) Set(v string) error {
+	for _, a := range strings.Split(v, ",") {
+		id, err := strconv.Atoi(a)
+		if err != nil || id < 1 {
+			return fmt.Errorf("%q isn't a player id", a)
+		}
+		*f = append(*f, id)
+	}
+	return nil
+}
+
+// The -p flag, picking players by id, by a range of ids, or by the
+// half of the room they stand in.
+type targetFlag struct {
+	t model.Target
+}
+
+func newTargetFlag(fs *flag.FlagSet) *targetFlag {
+	f := &targetFlag{}
+	fs.Var(f, "p",
+		"Only these `players`, comma separated: ids, a range such as "+
+			"3-6, and left or right for a half of the room; everyone if "+
+			"not given.")
+	return f
+}
+
+func (f *targetFlag) String() string {
+	ids := idsFlag(f.t.Ids)
+	s := []string{}
+	if len(ids) > 0 {
+		s = append(s, ids.String())
+	}
+	if f.t.Hi != 0 {
+		s = append(s, fmt.Sprintf("%d-%d", f.t.Lo, f.t.Hi))
+	}
+	switch f.t.Half {
+	case model.LeftHalf:
+		s = append(s, "left")
+	case model.RightHalf:
+		s = append(s, "right")
+	}
+	return strings.Join(s, ",")
+}
+
+func (f *targetFlag) Set(v string) error {
+	for _, a := range strings.Split(v, ",") {
+		switch {
+		case a == "left" || a == "right":
+			h := model.LeftHalf
+			if a == "right" {
+				h = model.RightHalf
+			}
+			if f.t.Half != model.Whole && f.t.Half != h {
+				return errors.New("can't pick both halves of the room")
+			}
+			f.t.Half = h
+		case strings.Contains(a, "-"):
+			if f.t.Hi != 0 {
+				return fmt.Errorf("%q is a second range of ids", a)
+			}
+			ends := strings.SplitN(a, "-", 2)
+			lo, err1 := strconv.Atoi(ends[0])
+			hi, err2 := strconv.Atoi(ends[1])
+			if err1 != nil || err2 != nil || lo < 1 || hi < lo {
+				return fmt.Errorf("%q isn't a range of player ids", a)
+			}
+			f.t.Lo, f.t.Hi = lo, hi
+		default:
+			ids := idsFlag(f.t.Ids)
+			if err := ids.Set(a); err != nil {
+				return err
+			}
+			f.t.Ids = ids
+		}
+	}
+	return nil
+}
+
+func (f *targetFlag) target() model.Target {
+	return f.t
+}
+
+func noArgs(fs *flag.FlagSet) error {
+	if fs.NArg() > 0 {
+		return usagef("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	return nil
+}
+
+// The one argument, which must be given.
+func oneArg(fs *flag.FlagSet, what string) (string, error) {
+	switch fs.NArg() {
+	case 0:
+		return "", usagef("missing %s", what)
+	case 1:
+		return fs.Arg(0), nil
+	}
+	return "", usagef("unexpected arguments: %s",
+		strings.Join(fs.Args()[1:], " "))
+}
+
+func floatArg(fs *flag.FlagSet, what string) (float32, error) {
+	a, err := oneArg(fs, what)
+	if err != nil {
+		return 0, err
+	}
+	x, err := strconv.ParseFloat(a, 32)
+	if err != nil {
+		return 0, usagef("%s %q isn't a number", what, a)
+	}
+	return float32(x), nil
+}
+
+func parseList(fs *flag.FlagSet, args []string) (action, error) {
+	asJSON := fs.Bool("json", false, "Print JSON, for scripts.")
+	t := newTargetFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if err := noArgs(fs); err != nil {
+		return nil, err
+	}
+	return func(s *session) error {
+		states, err := s.nm.List(t.target())
+		if *asJSON {
+			if e := printStatesJSON(s.out, states); e != nil {
+				log.Printf("Unable to print JSON: %v", e)
+			}
+		} else {
+			printStates(s.out, states)
+		}
+		return err
+	}, nil
+}
+
+func parseFire(fs *flag.FlagSet, args []string) (action, error) {
+	t := newTargetFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	count := 1
+	if fs.NArg() > 0 {
+		a, err := oneArg(fs, "count")
+		if err != nil {
+			return nil, err
+		}
+		if count, err = strconv.Atoi(a); err != nil || count < 1 {
+			return nil, usagef("count %q isn't a positive number", a)
+		}
+	}
+	return func(s *session) error {
+		return s.report(s.nm.FireBall(count, t.target()))
+	}, nil
+}
+
+func parseMc(fs *flag.FlagSet, args []string) (action, error) {
+	t := newTargetFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	mc, err := oneArg(fs, "command")
+	if err != nil {
+		return nil, err
+	}
+	known := false
+	for _, c := range masterCommands {
+		known = known || c == mc
+	}
+	if !known {
+		return nil, usagef("unknown command %q", mc)
+	}
+	return func(s *session) error {
+		return s.report(s.nm.DoMasterCommand(mc, t.target()))
+	}, nil
+}
+
+func parseQuit(fs *flag.FlagSet, args []string) (action, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() == 0 {
+		return nil, usagef("missing player id")
+	}
+	ids := &idsFlag{}
+	for _, a := range fs.Args() {
+		if err := ids.Set(a); err != nil {
+			return nil, usagef("%v", err)
+		}
+	}
+	return func(s *session) error {
+		failed := 0
+		for _, id := range *ids {
+			if err := s.nm.Quit(id); err != nil {
+				log.Printf("Unable to stop player %d: %v", id, err)
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d players didn't stop", failed, len(*ids))
+		}
+		return nil
+	}, nil
+}
+
+func parseGravity(fs *flag.FlagSet, args []string) (action, error) {
+	t := newTargetFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	g, err := floatArg(fs, "gravity")
+	if err != nil {
+		return nil, err
+	}
+	return func(s *session) error {
+		return s.report(s.nm.SetGravity(g, t.target()))
+	}, nil
+}
+
+func parsePause(fs *flag.FlagSet, args []string) (action, error) {
+	t := newTargetFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	pd, err := floatArg(fs, "duration")
+	if err != nil {
+		return nil, err
+	}
+	if pd <= 0 {
+		return nil, usagef("duration must be more than zero, got %v", pd)
+	}
+	return func(s *session) error {
+		return s.report(s.nm.SetPauseDuration(pd, t.target()))
+	}, nil
+}
+
+func parseGrid(fs *flag.FlagSet, args []string) (action, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	a, err := oneArg(fs, "columns")
+	if err != nil {
+		return nil, err
+	}
+	columns, err := strconv.Atoi(a)
+	if err != nil || columns < 0 {
+		return nil, usagef("columns %q isn't a number of columns", a)
+	}
+	return func(s *session) error {
+		room := s.nm.Room()
+		room.Columns = columns
+		return s.nm.SetRoom(room)
+	}, nil
+}
+
+func parseRing(fs *flag.FlagSet, args []string) (action, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	a, err := oneArg(fs, "on or off")
+	if err != nil {
+		return nil, err
+	}
+	if a != "on" && a != "off" {
+		return nil, usagef("want on or off, got %q", a)
+	}
+	return func(s *session) error {
+		room := s.nm.Room()
+		room.Ring = a == "on"
+		return s.nm.SetRoom(room)
+	}, nil
+}
+
+func parseLayout(fs *flag.FlagSet, args []string) (action, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	args = fs.Args()
+	if err := checkLayout(args); err != nil {
+		return nil, err
+	}
+	return func(s *session) error {
+		return doLayout(s, args)
+	}, nil
+}
+
+func parseHost(fs *flag.FlagSet, args []string) (action, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if err := noArgs(fs); err != nil {
+		return nil, err
+	}
+	return func(s *session) error {
+		if !s.host {
+			return usagef("give -host-ns to host the namespace")
+		}
+		return nil
+	}, nil
+}
+
+func parseHelp(fs *flag.FlagSet, args []string) (action, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	switch fs.NArg() {
+	case 0:
+		usage()
+		return nil, flag.ErrHelp
+	case 1:
+		c := findCommand(fs.Arg(0))
+		if c == nil {
+			return nil, usagef("unknown command %q", fs.Arg(0))
+		}
+		// Defining its flags is parsing nothing.
+		return c.parse(c.flagSet(os.Stderr), []string{"-h"})
+	}
+	return nil, usagef("unexpected arguments: %s",
+		strings.Join(fs.Args()[1:], " "))
+}
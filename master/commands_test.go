@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/monopole/volley/layout"
+	"github.com/monopole/volley/model"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Records the calls a command makes.  Calls it isn't expected to make
+// panic on the nil interface.
+type fakeNetManager struct {
+	model.NetManager
+	calls  []string
+	room   model.Room
+	states []*model.State
+}
+
+func (nm *fakeNetManager) record(format string, a ...interface{}) {
+	nm.calls = append(nm.calls, fmt.Sprintf(format, a...))
+}
+
+func (nm *fakeNetManager) FireBall(
+	count int, t model.Target) (model.Results, error) {
+	nm.record("FireBall %d %v", count, t)
+	return model.Results{}, nil
+}
+
+func (nm *fakeNetManager) SetGravity(
+	g float32, t model.Target) (model.Results, error) {
+	nm.record("SetGravity %v %v", g, t)
+	return model.Results{}, nil
+}
+
+func (nm *fakeNetManager) SetPauseDuration(
+	pd float32, t model.Target) (model.Results, error) {
+	nm.record("SetPauseDuration %v %v", pd, t)
+	return model.Results{}, nil
+}
+
+func (nm *fakeNetManager) DoMasterCommand(
+	c string, t model.Target) (model.Results, error) {
+	nm.record("DoMasterCommand %s %v", c, t)
+	return model.Results{}, nil
+}
+
+func (nm *fakeNetManager) Refresh() error {
+	return nil
+}
+
+func (nm *fakeNetManager) List(t model.Target) ([]*model.State, error) {
+	return nm.states, nil
+}
+
+func (nm *fakeNetManager) Poll() ([]*model.State, error) {
+	return nm.states, nil
+}
+
+func (nm *fakeNetManager) Quit(id int) error {
+	nm.record("Quit %d", id)
+	return nil
+}
+
+func (nm *fakeNetManager) Room() model.Room {
+	return nm.room
+}
+
+func (nm *fakeNetManager) ScreenSize(id int) (model.Dimensions, error) {
+	return model.Dimensions{}, nil
+}
+
+func (nm *fakeNetManager) SetRoom(room model.Room) error {
+	nm.room = room
+	return nil
+}
+
+// Run the command line given on nm, returning what parse complained of.
+func runOn(nm *fakeNetManager, line string) (string, error) {
+	var errOut bytes.Buffer
+	_, act, err := parse(strings.Fields(line), &errOut)
+	if err == nil && act != nil {
+		err = act(&session{nm, &bytes.Buffer{}, false})
+	}
+	return errOut.String(), err
+}
+
+func TestCommandsCallManager(t *testing.T) {
+	for _, tc := range []struct {
+		line string
+		want []string
+	}{
+		{"fire", []string{"FireBall 1 everyone"}},
+		{"fire 3", []string{"FireBall 3 everyone"}},
+		{"fire -p 2,4 -p 5 3", []string{"FireBall 3 players [2 4 5]"}},
+		{"gravity -p 1 -- -0.5", []string{"SetGravity -0.5 players [1]"}},
+		{"mc -p 2-4,7 kick",
+			[]string{"DoMasterCommand kick players [7], players 2-4"}},
+		{"pause -p left -p 3-5,left 2",
+			[]string{"SetPauseDuration 2 players 3-5, left half"}},
+		{"fire -p right", []string{"FireBall 1 right half"}},
+		{"quit 2 3", []string{"Quit 2", "Quit 3"}},
+	} {
+		nm := &fakeNetManager{}
+		if _, err := runOn(nm, tc.line); err != nil {
+			t.Errorf("%q: unexpected error %v", tc.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(nm.calls, tc.want) {
+			t.Errorf("%q: got calls %v, want %v", tc.line, nm.calls, tc.want)
+		}
+	}
+}
+
+func TestBadCommandLinesAreUsageErrors(t *testing.T) {
+	for _, line := range []string{
+		"",
+		"bogus",
+		"fire x",
+		"fire 0",
+		"fire 1 2",
+		"fire -p x 1",
+		"fire -p 4-2 1",
+		"fire -p 1-2,3-4 1",
+		"fire -p left,right 1",
+		"fire -p middle 1",
+		"mc",
+		"mc jump",
+		"quit",
+		"quit one",
+		"gravity",
+		"gravity heavy",
+		"pause 0",
+		"grid -1",
+		"ring maybe",
+		"layout place 1 2",
+		"layout place 1.5 2 3",
+		"layout place 1 NaN 2",
+		"layout place 1 2 +Inf",
+		"layout size 1 0 50",
+		"layout size 1 62.5 -1",
+		"layout spin",
+		"list extra",
+		"help bogus",
+	} {
+		nm := &fakeNetManager{}
+		errOut, err := runOn(nm, line)
+		if err == nil {
+			t.Errorf("%q: want an error", line)
+		}
+		if errOut == "" {
+			t.Errorf("%q: want a complaint", line)
+		}
+		if len(nm.calls) != 0 {
+			t.Errorf("%q: want no calls, got %v", line, nm.calls)
+		}
+	}
+}
+
+func TestHelpOnCommand(t *testing.T) {
+	errOut, err := runOn(&fakeNetManager{}, "fire -h")
+	if err != flag.ErrHelp {
+		t.Errorf("got error %v, want ErrHelp", err)
+	}
+	if !strings.Contains(errOut, "usage: master fire") ||
+		!strings.Contains(errOut, "-p players") {
+		t.Errorf("got help %q", errOut)
+	}
+}
+
+func TestRingAndGridChangeRoom(t *testing.T) {
+	nm := &fakeNetManager{}
+	if _, err := runOn(nm, "grid 3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runOn(nm, "ring on"); err != nil {
+		t.Fatal(err)
+	}
+	if nm.room.Columns != 3 || !nm.room.Ring {
+		t.Errorf("got room %v, want 3 columns in a ring", nm.room)
+	}
+}
+
+func TestLayoutShowWritesToSession(t *testing.T) {
+	room := layout.Place(model.Room{}, 2, 10, 20)
+	nm := &fakeNetManager{room: room}
+	var out bytes.Buffer
+	_, act, err := parse([]string{"layout", "show"}, &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := act(&session{nm, &out, false}); err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintln(room.Slots[0]); out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestLayoutTakesFractionalMillimetres(t *testing.T) {
+	nm := &fakeNetManager{}
+	for _, line := range []string{
+		"layout place 2 10.5 -3.25",
+		"layout size 2 62.5 110.75",
+	} {
+		if _, err := runOn(nm, line); err != nil {
+			t.Fatalf("%q: unexpected error %v", line, err)
+		}
+	}
+	want := model.Slot{2, 10.5, -3.25, 62.5, 110.75}
+	if s, ok := nm.room.Slot(2); !ok || s != want {
+		t.Errorf("got slot %v, want %v", s, want)
+	}
+}
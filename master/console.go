@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/monopole/volley/model"
+	"github.com/monopole/volley/topology"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// How often the console looks for players joining and leaving.
+const defaultRefresh = 2 * time.Second
+
+const consoleUsage = `Type any command as given on the command line, less "master", or:
+  kick, left, right, random, destroy   short for mc kick and so on
+  room                                 show the room now
+  exit                                 leave the console, as does EOF
+The room shows each row of players from the left, each player as
+[id:balls] between its left and right doors, an open door as _.`
+
+func parseConsole(fs *flag.FlagSet, args []string) (action, error) {
+	every := fs.Duration("every", defaultRefresh,
+		"How often to look for players joining and leaving.")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if err := noArgs(fs); err != nil {
+		return nil, err
+	}
+	if *every <= 0 {
+		return nil, usagef("-every must be more than zero, got %v", *every)
+	}
+	return func(s *session) error {
+		return console(s, os.Stdin, *every)
+	}, nil
+}
+
+// Read commands from in until EOF or exit, showing the room whenever
+// players come and go, or their doors change.
+func console(s *session, in io.Reader, every time.Duration) error {
+	lines := make(chan string)
+	go func() {
+		sc := bufio.NewScanner(in)
+		for sc.Scan() {
+			lines <- sc.Text()
+		}
+		close(lines)
+	}()
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	v := &roomView{}
+	v.refresh(s, true)
+	fmt.Fprint(s.out, "> ")
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				fmt.Fprintln(s.out)
+				return nil
+			}
+			if !consoleLine(s, v, line) {
+				return nil
+			}
+			fmt.Fprint(s.out, "> ")
+		case <-ticker.C:
+			if v.refresh(s, false) {
+				fmt.Fprint(s.out, "> ")
+			}
+		}
+	}
+}
+
+// Do what line says, returning false if it says to leave.
+func consoleLine(s *session, v *roomView, line string) bool {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return true
+	}
+	switch args[0] {
+	case "exit":
+		return false
+	case "room":
+		v.refresh(s, true)
+		return true
+	case "console", "host", "serve":
+		fmt.Fprintf(s.out, "%s makes no sense in the console.\n", args[0])
+		return true
+	}
+	_, act, err := parse(shorthand(args), s.out)
+	if err != nil {
+		// Already complained of, or helped with.
+		return true
+	}
+	if act == nil {
+		return true
+	}
+	if err := act(s); err != nil {
+		fmt.Fprintf(s.out, "%s failed: %v\n", args[0], err)
+	}
+	v.refresh(s, false)
+	return true
+}
+
+// Expand "kick -p 2" and the like into "mc -p 2 kick".
+func shorthand(args []string) []string {
+	for _, mc := range masterCommands {
+		if args[0] == mc {
+			// Flags go before the command.
+			return append(append([]string{"mc"}, args[1:]...), mc)
+		}
+	}
+	return args
+}
+
+// What the console last showed of the room.
+type roomView struct {
+	ids   map[int]bool
+	doors string // The room as last drawn, less the balls.
+}
+
+// Catch up with the room, saying who joined or left, and drawing it
+// if forced to or if the players or their doors changed.  Returns
+// true if anything was printed.
+func (v *roomView) refresh(s *session, force bool) bool {
+	room, states, err := lookAtRoom(s.nm)
+	if err != nil {
+		fmt.Fprintf(s.out, "\nUnable to find players: %v\n", err)
+		return true
+	}
+	printed := false
+	say := func(format string, a ...interface{}) {
+		if !printed && !force {
+			fmt.Fprintln(s.out)
+		}
+		printed = true
+		fmt.Fprintf(s.out, format, a...)
+	}
+	ids := make(map[int]bool)
+	for _, st := range states {
+		id := st.Player.Id()
+		ids[id] = true
+		if v.ids != nil && !v.ids[id] {
+			say("Player %d joined.\n", id)
+		}
+	}
+	for id := range v.ids {
+		if !ids[id] {
+			say("Player %d left.\n", id)
+		}
+	}
+	v.ids = ids
+	doors := drawRoom(room, states, false)
+	if force || doors != v.doors {
+		say("%s", drawRoom(room, states, true))
+	}
+	v.doors = doors
+	return printed
+}
+
+// Catch up with the room, and with what its players are up to, for
+// showing.  A player too busy to answer is left out of this look, not
+// taken for gone; only the transport says who has left.
+func lookAtRoom(nm model.NetManager) (model.Room, []*model.State, error) {
+	states, err := nm.Poll()
+	return nm.Room(), states, err
+}
+
+// Draw the players as they stand in the room, each as [id:balls]
+// between its left and right doors, an open door as _.
+func drawRoom(room model.Room, states []*model.State, balls bool) string {
+	byId := make(map[int]*model.State)
+	ids := []int{}
+	for _, st := range states {
+		byId[st.Player.Id()] = st
+		ids = append(ids, st.Player.Id())
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Room: %v; players: %d.\n", room, len(states))
+	for _, row := range topology.Rows(room, ids) {
+		b.WriteString(" ")
+		for _, id := range row {
+			st := byId[id]
+			b.WriteString(" " + door(st, model.Left, "["))
+			fmt.Fprintf(&b, "%d", id)
+			if balls {
+				fmt.Fprintf(&b, ":%d", len(st.Balls))
+			}
+			b.WriteString(door(st, model.Right, "]"))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// How a player's door in direction d looks, given how it looks shut.
+func door(st *model.State, d model.Direction, shut string) string {
+	for _, dc := range st.Doors {
+		if dc.D == d && dc.S == model.Open {
+			return "_"
+		}
+	}
+	return shut
+}
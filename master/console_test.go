@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"github.com/monopole/volley/model"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The state of a player with the given balls, and doors open as given.
+func stateOf(id int, balls int, open ...model.Direction) *model.State {
+	s := &model.State{Player: model.NewPlayer(id)}
+	for i := 0; i < balls; i++ {
+		s.Balls = append(s.Balls, &model.Ball{})
+	}
+	for _, d := range open {
+		s.Doors = append(s.Doors, model.WholeDoor(model.Open, d))
+	}
+	return s
+}
+
+func TestDrawRoom(t *testing.T) {
+	states := []*model.State{
+		stateOf(1, 2, model.Right),
+		stateOf(2, 0, model.Left, model.Right),
+		stateOf(3, 1, model.Left),
+	}
+	got := drawRoom(model.Room{Columns: 2}, states, true)
+	want := "Room: 2 columns; players: 3.\n  [1:2_ _2:0_\n  _3:1]\n"
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestConsoleRunsCommandsAndShowsComings(t *testing.T) {
+	nm := &fakeNetManager{states: []*model.State{stateOf(1, 0)}}
+	var out bytes.Buffer
+	in := strings.NewReader("fire 2\nkick -p 1\nbogus\nexit\nfire\n")
+	if err := console(&session{nm, &out, false}, in, time.Hour); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{
+		"FireBall 2 everyone",
+		"DoMasterCommand kick players [1]",
+	}
+	if !reflect.DeepEqual(nm.calls, want) {
+		t.Errorf("got calls %v, want %v", nm.calls, want)
+	}
+	for _, s := range []string{"[1:0]", `unknown command "bogus"`} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("output lacks %q:\n%s", s, out.String())
+		}
+	}
+}
+
+func TestRoomViewSaysWhoCameAndWent(t *testing.T) {
+	nm := &fakeNetManager{states: []*model.State{stateOf(1, 0)}}
+	var out bytes.Buffer
+	s := &session{nm, &out, false}
+	v := &roomView{}
+	v.refresh(s, true)
+	out.Reset()
+	if v.refresh(s, false) {
+		t.Errorf("nothing changed, yet printed %q", out.String())
+	}
+	nm.states = []*model.State{stateOf(2, 0)}
+	if !v.refresh(s, false) {
+		t.Fatalf("printed nothing")
+	}
+	for _, s := range []string{"Player 2 joined.", "Player 1 left.", "[2:0]"} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("output lacks %q:\n%s", s, out.String())
+		}
+	}
+}
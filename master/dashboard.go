@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/monopole/volley/model"
+	"github.com/monopole/volley/topology"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDashboardAddr = "localhost:8080"
+	// How often the dashboard asks players what they're up to.
+	defaultDashboardRefresh = time.Second
+)
+
+// What each control of the dashboard posts, by the command it runs.
+var dashboardParams = map[string]string{
+	"fire":    "count",
+	"mc":      "name",
+	"gravity": "g",
+	"pause":   "duration",
+}
+
+func parseServe(fs *flag.FlagSet, args []string) (action, error) {
+	addr := fs.String("addr", defaultDashboardAddr,
+		"Where to serve the dashboard, as host:port.")
+	every := fs.Duration("every", defaultDashboardRefresh,
+		"How often to ask players what they're up to.")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if err := noArgs(fs); err != nil {
+		return nil, err
+	}
+	if *every <= 0 {
+		return nil, usagef("-every must be more than zero, got %v", *every)
+	}
+	return func(s *session) error {
+		l, err := net.Listen("tcp", *addr)
+		if err != nil {
+			return err
+		}
+		db := newDashboard(s)
+		go db.run(*every)
+		log.Printf("Dashboard at http://%s/; interrupt to stop.", l.Addr())
+		return http.Serve(l, db.handler())
+	}, nil
+}
+
+// A player as the dashboard shows it.
+type playerJSON struct {
+	Id            int
+	Balls         int
+	Open          []string // Directions of open doors.
+	Gravity       float32
+	PauseDuration float32
+}
+
+// The room as the dashboard shows it.
+type roomJSON struct {
+	Room    string
+	Players int
+	Rows    [][]playerJSON // As the players stand, from the top left.
+	Error   string         // Why players couldn't be found, if so.
+}
+
+// Serves a page showing the room, updated as it changes, with
+// controls for the master's calls.
+type dashboard struct {
+	s    *session             // Used only by run, as s.nm isn't concurrent.
+	ops  chan func()          // For run to do, one at a time.
+	mu   sync.Mutex           // Guards last and subs, never held across calls.
+	last []byte               // The room, as JSON.
+	subs map[chan []byte]bool // Pages watching the room.
+}
+
+func newDashboard(s *session) *dashboard {
+	return &dashboard{
+		s, make(chan func()), sync.Mutex{}, nil, make(map[chan []byte]bool)}
+}
+
+func (db *dashboard) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", db.handlePage)
+	mux.HandleFunc("/room", db.handleRoom)
+	mux.HandleFunc("/events", db.handleEvents)
+	for name := range dashboardParams {
+		mux.HandleFunc("/"+name, db.handleCommand)
+	}
+	return mux
+}
+
+// Do what's asked of the dashboard, one thing at a time, and refresh
+// the room every so often in between, forever.  Pages reading the room
+// wait on none of it.
+func (db *dashboard) run(every time.Duration) {
+	next := time.After(0)
+	for {
+		select {
+		case op := <-db.ops:
+			op()
+		case <-next:
+			db.refresh()
+			next = time.After(every)
+		}
+	}
+}
+
+// Have run do f, waiting until it has.
+func (db *dashboard) do(f func()) {
+	done := make(chan bool)
+	db.ops <- func() {
+		f()
+		close(done)
+	}
+	<-done
+}
+
+// Catch up with the room, and tell watching pages if it changed.  Only
+// run calls this.
+func (db *dashboard) refresh() {
+	rj := roomJSON{Rows: [][]playerJSON{}}
+	room, states, err := lookAtRoom(db.s.nm)
+	if err != nil {
+		rj.Error = err.Error()
+	}
+	rj.Room = room.String()
+	rj.Players = len(states)
+	byId := make(map[int]*model.State)
+	ids := []int{}
+	for _, st := range states {
+		byId[st.Player.Id()] = st
+		ids = append(ids, st.Player.Id())
+	}
+	for _, row := range topology.Rows(room, ids) {
+		pjs := []playerJSON{}
+		for _, id := range row {
+			st := byId[id]
+			pj := playerJSON{id, len(st.Balls), []string{},
+				st.Gravity, st.PauseDuration}
+			for _, dc := range st.Doors {
+				if dc.S == model.Open {
+					pj.Open = append(pj.Open, dc.D.String())
+				}
+			}
+			pjs = append(pjs, pj)
+		}
+		rj.Rows = append(rj.Rows, pjs)
+	}
+	data, err := json.Marshal(rj)
+	if err != nil {
+		log.Printf("Unable to encode room: %v", err)
+		return
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if bytes.Equal(data, db.last) {
+		return
+	}
+	db.last = data
+	for ch := range db.subs {
+		select {
+		case ch <- data:
+		default:
+			// Behind; it gets the next change.
+		}
+	}
+}
+
+func (db *dashboard) subscribe() (chan []byte, []byte) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	ch := make(chan []byte, 1)
+	db.subs[ch] = true
+	return ch, db.last
+}
+
+func (db *dashboard) unsubscribe(ch chan []byte) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	delete(db.subs, ch)
+}
+
+func (db *dashboard) handlePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, dashboardPage)
+}
+
+func (db *dashboard) handleRoom(w http.ResponseWriter, r *http.Request) {
+	db.mu.Lock()
+	data := db.last
+	db.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// Send the room as server-sent events, once now and again whenever it
+// changes, until the page goes away.
+func (db *dashboard) handleEvents(w http.ResponseWriter, r *http.Request) {
+	f, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	ch, data := db.subscribe()
+	defer db.unsubscribe(ch)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	for {
+		if data != nil {
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			f.Flush()
+		}
+		select {
+		case data = <-ch:
+		case <-r.Context().Done():
+			// The page went away.
+			return
+		}
+	}
+}
+
+// Run the command the path names, with the value of its parameter and
+// p, if any, as its arguments, answering with what it printed.  Only
+// the dashboard's own page may post; other sites a browser visits
+// can't.
+func (db *dashboard) handleCommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+	if !sameOrigin(r) {
+		http.Error(w, "cross-origin request", http.StatusForbidden)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	args := []string{name}
+	if p := r.FormValue("p"); p != "" {
+		args = append(args, "-p", p)
+	}
+	if v := r.FormValue(dashboardParams[name]); v != "" {
+		args = append(args, "--", v)
+	}
+	_, act, err := parse(args, ioutil.Discard)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var out bytes.Buffer
+	db.do(func() {
+		err = act(&session{db.s.nm, &out, db.s.host})
+	})
+	go db.do(db.refresh)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		fmt.Fprintf(&out, "%s failed: %v\n", name, err)
+	}
+	w.Write(out.Bytes())
+}
+
+// Whether r came from a page served here, or from no page at all.
+// Browsers send Origin with every cross-site POST.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+const dashboardPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>volley master</title>
+<style>
+body { font-family: sans-serif; margin: 1em; }
+.row { display: flex; margin-bottom: 1em; }
+.player { width: 6em; height: 4em; margin-right: 0.5em; padding: 0.3em;
+  border: 4px solid #a33; text-align: center; }
+.open-left { border-left-color: #3a3; }
+.open-right { border-right-color: #3a3; }
+.open-up { border-top-color: #3a3; }
+.open-down { border-bottom-color: #3a3; }
+.id { font-size: 1.5em; font-weight: bold; }
+fieldset { margin-bottom: 1em; }
+pre { background: #eee; padding: 0.5em; min-height: 3em; }
+</style>
+</head>
+<body>
+<h1>volley</h1>
+<p id="summary">Waiting for the room...</p>
+<div id="room"></div>
+<fieldset>
+<legend>Players</legend>
+<label>Only <input id="p" size="12" placeholder="everyone"></label>
+(ids, a range such as 3-6, left or right, comma separated)
+</fieldset>
+<fieldset>
+<legend>Balls</legend>
+<input id="count" type="number" min="1" value="1" style="width: 4em">
+<button onclick="send('fire', {count: val('count')})">Fire</button>
+<button onclick="send('mc', {name: 'kick'})">Kick</button>
+<button onclick="send('mc', {name: 'left'})">Left</button>
+<button onclick="send('mc', {name: 'right'})">Right</button>
+<button onclick="send('mc', {name: 'random'})">Random</button>
+<button onclick="send('mc', {name: 'destroy'})">Destroy</button>
+</fieldset>
+<fieldset>
+<legend>Physics</legend>
+<label>Gravity <input id="g" type="range" min="0" max="0.1" step="0.005"
+  value="0" onchange="send('gravity', {g: val('g')})"></label>
+<span id="gv">0</span><br>
+<label>Pause <input id="duration" type="range" min="0.5" max="10" step="0.5"
+  value="3" onchange="send('pause', {duration: val('duration')})"></label>
+<span id="dv">3</span>
+</fieldset>
+<pre id="out"></pre>
+<script>
+function val(id) { return document.getElementById(id).value; }
+function text(id, s) { document.getElementById(id).textContent = s; }
+document.getElementById('g').oninput = function() { text('gv', val('g')); };
+document.getElementById('duration').oninput = function() {
+  text('dv', val('duration'));
+};
+function send(cmd, params) {
+  params.p = val('p');
+  var body = Object.keys(params).map(function(k) {
+    return encodeURIComponent(k) + '=' + encodeURIComponent(params[k]);
+  }).join('&');
+  var xhr = new XMLHttpRequest();
+  xhr.open('POST', '/' + cmd);
+  xhr.setRequestHeader('Content-Type', 'application/x-www-form-urlencoded');
+  xhr.onload = function() { text('out', xhr.responseText); };
+  xhr.send(body);
+}
+function show(room) {
+  text('summary', room.Error ? 'Unable to find players: ' + room.Error :
+    room.Players + ' players, ' + room.Room + '.');
+  var div = document.getElementById('room');
+  div.innerHTML = '';
+  room.Rows.forEach(function(row) {
+    var r = document.createElement('div');
+    r.className = 'row';
+    row.forEach(function(p) {
+      var e = document.createElement('div');
+      e.className = 'player' + p.Open.map(function(d) {
+        return ' open-' + d;
+      }).join('');
+      e.innerHTML = '<div class="id">' + p.Id + '</div>' +
+        p.Balls + ' balls<br>g ' + p.Gravity.toFixed(3) +
+        ', pause ' + p.PauseDuration;
+      r.appendChild(e);
+    });
+    div.appendChild(r);
+  });
+}
+new EventSource('/events').onmessage = function(e) {
+  show(JSON.parse(e.data));
+};
+</script>
+</body>
+</html>
+`
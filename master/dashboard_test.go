@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/monopole/volley/model"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testDashboard(nm *fakeNetManager) (*dashboard, *httptest.Server) {
+	db := newDashboard(&session{nm, &bytes.Buffer{}, false})
+	go db.run(time.Hour)
+	db.do(db.refresh)
+	return db, httptest.NewServer(db.handler())
+}
+
+func TestDashboardShowsRoomInLayoutOrder(t *testing.T) {
+	nm := &fakeNetManager{
+		room: model.Room{Columns: 1},
+		states: []*model.State{
+			stateOf(1, 2, model.Down),
+			stateOf(2, 0, model.Up),
+		},
+	}
+	_, srv := testDashboard(nm)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/room")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var rj roomJSON
+	if err := json.NewDecoder(resp.Body).Decode(&rj); err != nil {
+		t.Fatal(err)
+	}
+	want := roomJSON{"1 columns", 2, [][]playerJSON{
+		{{1, 2, []string{"down"}, 0, 0}},
+		{{2, 0, []string{"up"}, 0, 0}},
+	}, ""}
+	if !reflect.DeepEqual(rj, want) {
+		t.Errorf("got %+v, want %+v", rj, want)
+	}
+}
+
+func TestDashboardRunsCommands(t *testing.T) {
+	nm := &fakeNetManager{}
+	_, srv := testDashboard(nm)
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		path   string
+		params url.Values
+		status int
+	}{
+		{"/fire", url.Values{"count": {"2"}, "p": {"1,3"}}, http.StatusOK},
+		{"/mc", url.Values{"name": {"kick"}}, http.StatusOK},
+		{"/gravity", url.Values{"g": {"-0.02"}}, http.StatusOK},
+		{"/gravity", url.Values{"g": {"heavy"}}, http.StatusBadRequest},
+		{"/mc", url.Values{"name": {"jump"}}, http.StatusBadRequest},
+	} {
+		resp, err := http.PostForm(srv.URL+tc.path, tc.params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s %v: got status %d, want %d",
+				tc.path, tc.params, resp.StatusCode, tc.status)
+		}
+	}
+	resp, err := http.Get(srv.URL + "/fire")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET /fire: got status %d", resp.StatusCode)
+	}
+	want := []string{
+		"FireBall 2 players [1 3]",
+		"DoMasterCommand kick everyone",
+		"SetGravity -0.02 everyone",
+	}
+	if !reflect.DeepEqual(nm.calls, want) {
+		t.Errorf("got calls %v, want %v", nm.calls, want)
+	}
+}
+
+func TestDashboardSendsChanges(t *testing.T) {
+	nm := &fakeNetManager{states: []*model.State{stateOf(1, 0)}}
+	db, srv := testDashboard(nm)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	events := bufio.NewReader(resp.Body)
+	next := func() roomJSON {
+		for {
+			line, err := events.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.HasPrefix(line, "data: ") {
+				var rj roomJSON
+				json.Unmarshal([]byte(line[len("data: "):]), &rj)
+				return rj
+			}
+		}
+	}
+	if rj := next(); rj.Players != 1 {
+		t.Errorf("got %+v, want one player", rj)
+	}
+	db.do(func() {
+		nm.states = append(nm.states, stateOf(2, 0))
+		db.refresh()
+	})
+	if rj := next(); rj.Players != 2 {
+		t.Errorf("got %+v, want two players", rj)
+	}
+}
+
+// A manager whose players take until release is closed to answer.
+type stuckNetManager struct {
+	fakeNetManager
+	release chan bool
+}
+
+func (nm *stuckNetManager) Poll() ([]*model.State, error) {
+	<-nm.release
+	return nil, nil
+}
+
+func TestDashboardPagesDoNotWaitOnPoll(t *testing.T) {
+	nm := &stuckNetManager{fakeNetManager{}, make(chan bool)}
+	db := newDashboard(&session{nm, &bytes.Buffer{}, false})
+	go db.run(time.Hour)
+	srv := httptest.NewServer(db.handler())
+	defer srv.Close()
+	defer close(nm.release)
+
+	c := &http.Client{Timeout: time.Second}
+	resp, err := c.Get(srv.URL + "/room")
+	if err != nil {
+		t.Fatalf("room unavailable during a poll: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestDashboardEventsEndWithRequest(t *testing.T) {
+	db, srv := testDashboard(&fakeNetManager{})
+	srv.Close()
+
+	// A recorder can flush, but can't say when the client hangs up.
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest("GET", "/events", nil).WithContext(ctx)
+	done := make(chan bool)
+	go func() {
+		db.handleEvents(httptest.NewRecorder(), r)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("still sending events after the request ended")
+	}
+}
+
+func TestDashboardRefusesOtherSites(t *testing.T) {
+	nm := &fakeNetManager{}
+	_, srv := testDashboard(nm)
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		origin string
+		status int
+	}{
+		{"http://evil.example", http.StatusForbidden},
+		{"null", http.StatusForbidden},
+		{srv.URL, http.StatusOK},
+	} {
+		req, err := http.NewRequest("POST", srv.URL+"/fire",
+			strings.NewReader("count=1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Origin", tc.origin)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Errorf("from %s: got status %d, want %d",
+				tc.origin, resp.StatusCode, tc.status)
+		}
+	}
+	if want := []string{"FireBall 1 everyone"}; !reflect.DeepEqual(
+		nm.calls, want) {
+		t.Errorf("got calls %v, want %v", nm.calls, want)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"github.com/monopole/volley/layout"
+	"github.com/monopole/volley/model"
+	"math"
+	"strconv"
+)
+
+const layoutUsage = `layout show
+layout place <id> <x> <y>
+layout size <id> <w> <h>
+layout fit [<id> ...]
+layout order <id> <id> ...
+layout remove <id>
+layout clear
+layout save <name>
+layout load <name>
+Positions and sizes are in millimetres, with y growing downward, so
+a screen standing higher than its neighbor has the smaller y.  A
+player's first slot takes the size its screen advertises, if any;
+fit does the same for slots already placed.`
+
+// Check that args make sense to doLayout, before reaching anyone.
+func checkLayout(args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	n := len(args) - 1
+	switch args[0] {
+	case "show", "clear":
+		if n != 0 {
+			return usagef("layout %s takes no arguments", args[0])
+		}
+		return nil
+	case "save", "load":
+		if n != 1 {
+			return usagef("layout %s takes a name", args[0])
+		}
+		return nil
+	case "place", "size":
+		if n != 3 {
+			return usagef("layout %s takes a player id and two numbers", args[0])
+		}
+		_, a, b, err := measurements(args[1:])
+		if err != nil {
+			return usagef("layout %s: %v", args[0], err)
+		}
+		if args[0] == "size" && (a <= 0 || b <= 0) {
+			return usagef("layout size takes a width and height above zero")
+		}
+		return nil
+	case "fit", "order", "remove":
+	default:
+		return usagef("unknown layout subcommand %q", args[0])
+	}
+	ids, err := atois(args[1:])
+	if err != nil {
+		return usagef("layout %s: %v", args[0], err)
+	}
+	if args[0] == "order" && len(ids) == 0 {
+		return usagef("layout order takes player ids")
+	}
+	if args[0] == "remove" && len(ids) != 1 {
+		return usagef("layout remove takes a player id")
+	}
+	return nil
+}
+
+// Show or change the layout of the room, or save or load it by name.
+// Shows go to the session's output.
+func doLayout(s *session, args []string) error {
+	if err := checkLayout(args); err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		args = []string{"show"}
+	}
+	room := s.nm.Room()
+	ids, _ := atois(args[1:])
+	var err error
+	switch args[0] {
+	case "show":
+		if len(room.Slots) == 0 {
+			fmt.Fprintf(s.out, "No layout; players stand in %v.\n", room)
+		}
+		for _, slot := range room.Slots {
+			fmt.Fprintln(s.out, slot)
+		}
+		return nil
+	case "save":
+		return layout.Save(layout.Dir(), args[1], room)
+	case "load":
+		loaded, err := layout.Load(layout.Dir(), args[1])
+		if err != nil {
+			return err
+		}
+		return s.nm.SetRoom(loaded)
+	case "clear":
+		room.Slots = nil
+	case "order":
+		room = layout.Order(fitNew(s.nm, room, ids), ids)
+	case "remove":
+		room = layout.Remove(room, ids[0])
+	case "place", "size":
+		id, a, b, _ := measurements(args[1:])
+		if args[0] == "place" {
+			room = layout.Place(fitNew(s.nm, room, []int{id}), id, a, b)
+		} else if room, err = layout.Resize(room, id, a, b); err != nil {
+			return err
+		}
+	case "fit":
+		if len(ids) == 0 {
+			for _, slot := range room.Slots {
+				ids = append(ids, slot.Id)
+			}
+		}
+		for _, id := range ids {
+			if room, err = fit(s.nm, room, id); err != nil {
+				return err
+			}
+		}
+	}
+	return s.nm.SetRoom(room)
+}
+
+// Size the given player's slot to fit the screen it advertises,
+// placing it at the origin if it had no slot.
+func fit(nm model.NetManager, room model.Room, id int) (model.Room, error) {
+	d, err := nm.ScreenSize(id)
+	if err != nil {
+		return room, err
+	}
+	if d.W <= 0 || d.H <= 0 {
+		return room, fmt.Errorf("player %d doesn't know its screen size", id)
+	}
+	if _, ok := room.Slot(id); !ok {
+		room = layout.Place(room, id, 0, 0)
+	}
+	return layout.Resize(room, id, d.W, d.H)
+}
+
+// Give those of the given players without slots one the size of
+// their screens, where known.  Others get the default size later.
+func fitNew(nm model.NetManager, room model.Room, ids []int) model.Room {
+	for _, id := range ids {
+		if _, ok := room.Slot(id); ok {
+			continue
+		}
+		if fitted, err := fit(nm, room, id); err == nil {
+			room = fitted
+		}
+	}
+	return room
+}
+
+// The player id and the two lengths, in millimetres, that layout place
+// and size take.  Lengths may be fractional, but must be finite.
+func measurements(args []string) (int, float32, float32, error) {
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("%q isn't a player id", args[0])
+	}
+	var ab [2]float32
+	for i, a := range args[1:] {
+		f, err := strconv.ParseFloat(a, 32)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return 0, 0, 0, fmt.Errorf("%q isn't a number", a)
+		}
+		ab[i] = float32(f)
+	}
+	return id, ab[0], ab[1], nil
+}
+
+func atois(args []string) ([]int, error) {
+	result := make([]int, len(args))
+	for i, a := range args {
+		n, err := strconv.Atoi(a)
+		if err != nil {
+			return nil, fmt.Errorf("%q isn't a number", a)
+		}
+		result[i] = n
+	}
+	return result, nil
+}
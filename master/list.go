@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/monopole/volley/model"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Print what every player is up to, one line per player.
+func printStates(out io.Writer, states []*model.State) {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "PLAYER\tBALLS\tOPEN DOORS\tGRAVITY\tPAUSE\tSIZE\tUPTIME\tVERSION")
+	for _, s := range states {
+		fmt.Fprintf(w, "%v\t%d\t%s\t%.3f\t%.2f\t%s\t%v\t%s\n",
+			s.Player, len(s.Balls), openDoors(s.Doors), s.Gravity,
+			s.PauseDuration, sizeOf(s.Size), s.Uptime-s.Uptime%time.Second,
+			s.Version)
+	}
+	w.Flush()
+}
+
+func openDoors(doors []model.DoorCommand) string {
+	var open []string
+	for _, dc := range doors {
+		if dc.S == model.Open {
+			open = append(open, dc.String()[len("open-"):])
+		}
+	}
+	if len(open) == 0 {
+		return "-"
+	}
+	return strings.Join(open, ",")
+}
+
+func sizeOf(d model.Dimensions) string {
+	if d.W <= 0 || d.H <= 0 {
+		return "?"
+	}
+	return fmt.Sprintf("%.0fx%.0fmm", d.W, d.H)
+}
+
+// The JSON form of a player's state.
+type stateJSON struct {
+	Id            int
+	Balls         []ballJSON
+	Doors         []doorJSON
+	Gravity       float32
+	PauseDuration float32
+	Size          model.Dimensions
+	UptimeSeconds float64
+	Version       string
+}
+
+// Position as fractions of the screen, and velocity.
+type ballJSON struct {
+	X, Y, Dx, Dy float32
+}
+
+type doorJSON struct {
+	Dir    string
+	Open   bool
+	Lo, Hi float32
+}
+
+// Print what every player is up to as a JSON array, in player order.
+func printStatesJSON(out io.Writer, states []*model.State) error {
+	js := []stateJSON{}
+	for _, s := range states {
+		j := stateJSON{
+			Id:            s.Player.Id(),
+			Balls:         []ballJSON{},
+			Doors:         []doorJSON{},
+			Gravity:       s.Gravity,
+			PauseDuration: s.PauseDuration,
+			Size:          s.Size,
+			UptimeSeconds: s.Uptime.Seconds(),
+			Version:       s.Version,
+		}
+		for _, b := range s.Balls {
+			p, v := b.GetPos(), b.GetVel()
+			j.Balls = append(j.Balls, ballJSON{p.X, p.Y, v.X, v.Y})
+		}
+		for _, dc := range s.Doors {
+			j.Doors = append(j.Doors,
+				doorJSON{dc.D.String(), dc.S == model.Open, dc.Lo, dc.Hi})
+		}
+		js = append(js, j)
+	}
+	data, err := json.MarshalIndent(js, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "%s\n", data)
+	return err
+}
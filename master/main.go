@@ -1,35 +1,51 @@
 package main
 
 import (
-	"fmt"
+	"flag"
 	"github.com/monopole/volley/config"
-	"github.com/monopole/volley/net"
+	"github.com/monopole/volley/peer"
+	"github.com/monopole/volley/transport"
 	"log"
 	"os"
-	"strconv"
+	"os/signal"
 	"time"
 )
 
+// How to reach the players.
+var netFlags = transport.RegisterFlags(flag.CommandLine)
+
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("need args")
-		return
+	flag.Usage = usage
+	flag.Parse()
+	os.Exit(run(flag.Args()))
+}
+
+// Run the command given by args, returning the exit code.
+func run(args []string) int {
+	c, act, err := parse(args, os.Stderr)
+	if err == flag.ErrHelp {
+		return exitOk
 	}
-	nsRoot := "/" + net.DetermineNamespaceRoot()
-	log.Printf("Using v23.namespace.root=%s", nsRoot)
-	nm := net.NewV23Manager(
-		config.Chatty, config.RootName, true, nsRoot)
+	if err != nil {
+		return exitUsage
+	}
+	if act == nil {
+		return exitOk
+	}
+	root, host := transport.FindRoot(netFlags, true)
+	nm := peer.NewManager(
+		config.Chatty, true, transport.New(netFlags, root, host, true))
 
 	chReady := nm.GetReady()
 
 	select {
 	case <-time.After(5 * time.Second):
 		log.Printf("Ready loop timed out.\n")
-		return
+		return exitFailed
 	case ready := <-chReady:
 		if !ready {
 			log.Printf("Seem unable to start NM.\n")
-			return
+			return exitFailed
 		}
 	}
 	nm.JoinGame(nil)
@@ -37,30 +53,20 @@ func main() {
 		log.Printf("NM now running.\n")
 	}
 
-	switch os.Args[1] {
-	case "list":
-		nm.List()
-	case "mc":
-		if len(os.Args[2]) > 0 {
-			nm.DoMasterCommand(os.Args[2])
-		} else {
-			log.Println("Don't understand mc arg")
+	if err := act(&session{nm, os.Stdout, host}); err != nil {
+		log.Printf("%s failed: %v", c.name, err)
+		if _, ok := err.(*usageError); ok {
+			return exitUsage
 		}
-	case "quit":
-		id, _ := strconv.Atoi(os.Args[2])
-		nm.Quit(id)
-	case "fire":
-		count, _ := strconv.Atoi(os.Args[2])
-		nm.FireBall(count)
-	case "pause":
-		x, _ := strconv.ParseFloat(os.Args[2], 32)
-		pd := float32(x)
-		nm.SetPauseDuration(pd)
-	case "gravity":
-		x, _ := strconv.ParseFloat(os.Args[2], 32)
-		g := float32(x)
-		nm.SetGravity(g)
-	default:
-		log.Printf("Don't understand: %s\n", os.Args[1])
+		return exitFailed
+	}
+	if host {
+		// Players found the namespace here, so keep it up.
+		log.Printf("Hosting the namespace at %s; interrupt to stop.", root)
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, os.Interrupt)
+		<-ch
+		nm.Stop()
 	}
+	return exitOk
 }
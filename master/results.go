@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"github.com/monopole/volley/model"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// Print how a call to every player went, one line per call, then a
+// count of those that failed.
+func printResults(out io.Writer, rs model.Results) {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "PLAYER\tOP\tMS\tRESULT")
+	for _, r := range rs {
+		result := "ok"
+		if r.Err != nil {
+			result = r.Err.Error()
+		}
+		fmt.Fprintf(w, "%v\t%s\t%.1f\t%s\n",
+			r.Player, r.Op, float64(r.Took)/float64(time.Millisecond), result)
+	}
+	w.Flush()
+	fmt.Fprintf(out, "%d of %d calls failed.\n", len(rs.Failures()), len(rs))
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const scriptUsage = `A script has one command per line, as given to the console, and:
+  wait <duration>   wait, e.g. 500ms, 2s or 1m
+  repeat <n>        do the lines up to the matching end n times
+  end
+A # starts a comment.  Waits are counted from the start of the script,
+so a slow command doesn't push back those after it.  For example:
+  fire 3
+  wait 2s
+  repeat 3
+    kick -p 2
+    wait 1s
+    random
+    wait 1s
+  end
+  gravity 0.02`
+
+// Commands that make no sense in a script.
+var unscripted = []string{
+	"console", "exit", "help", "host", "room", "run", "serve"}
+
+func parseRun(fs *flag.FlagSet, args []string) (action, error) {
+	dryRun := fs.Bool("dry-run", false,
+		"Print when each command would run, without joining the game.")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	name, err := oneArg(fs, "script")
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, usagef("%v", err)
+	}
+	defer f.Close()
+	tl, err := readScript(name, f)
+	if err != nil {
+		return nil, err
+	}
+	if *dryRun {
+		tl.print(os.Stdout)
+		return nil, nil
+	}
+	return tl.run, nil
+}
+
+// A command of a script, and when to run it.
+type step struct {
+	at   time.Duration // From the start of the script.
+	pos  string        // Where in the script, as name:line.
+	text string
+	act  action
+}
+
+// What a script does when.
+type timeline struct {
+	steps []step
+	end   time.Duration // Of the last wait, if after every step.
+}
+
+// Print when each step would run.
+func (tl *timeline) print(out io.Writer) {
+	for _, st := range tl.steps {
+		fmt.Fprintf(out, "%7.1fs  %s\n", st.at.Seconds(), st.text)
+	}
+	fmt.Fprintf(out, "%7.1fs  done\n", tl.end.Seconds())
+}
+
+// Run each step in time, carrying on past those that fail.
+func (tl *timeline) run(s *session) error {
+	start := time.Now()
+	failed := 0
+	for _, st := range tl.steps {
+		time.Sleep(st.at - time.Since(start))
+		fmt.Fprintf(s.out, "%7.1fs  %s\n", time.Since(start).Seconds(), st.text)
+		if err := st.act(s); err != nil {
+			fmt.Fprintf(s.out, "%s: %s failed: %v\n", st.pos, st.text, err)
+			failed++
+		}
+	}
+	time.Sleep(tl.end - time.Since(start))
+	if failed > 0 {
+		return fmt.Errorf("%d of %d steps failed", failed, len(tl.steps))
+	}
+	return nil
+}
+
+// A line of a script, less comments.
+type scriptLine struct {
+	n    int
+	args []string
+}
+
+type script struct {
+	name  string
+	lines []scriptLine
+}
+
+// Read the script in r, checking every command before any is run.
+func readScript(name string, r io.Reader) (*timeline, error) {
+	sc := &script{name, nil}
+	in := bufio.NewScanner(r)
+	for n := 1; in.Scan(); n++ {
+		text := in.Text()
+		if i := strings.Index(text, "#"); i >= 0 {
+			text = text[:i]
+		}
+		if args := strings.Fields(text); len(args) > 0 {
+			sc.lines = append(sc.lines, scriptLine{n, args})
+		}
+	}
+	if err := in.Err(); err != nil {
+		return nil, usagef("%s: %v", name, err)
+	}
+	steps, end, i, err := sc.block(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	if i < len(sc.lines) {
+		return nil, sc.errorf(sc.lines[i], "end without repeat")
+	}
+	return &timeline{steps, end}, nil
+}
+
+func (sc *script) errorf(
+	l scriptLine, format string, a ...interface{}) error {
+	return usagef("%s:%d: %s", sc.name, l.n, fmt.Sprintf(format, a...))
+}
+
+// Turn the lines from i on into steps starting at time at, up to an
+// end or the end of the script.  Returns the steps, when they finish,
+// and the index of the end, if any.
+func (sc *script) block(
+	i int, at time.Duration) ([]step, time.Duration, int, error) {
+	steps := []step{}
+	for ; i < len(sc.lines); i++ {
+		l := sc.lines[i]
+		switch l.args[0] {
+		case "end":
+			return steps, at, i, nil
+		case "wait":
+			if len(l.args) != 2 {
+				return nil, 0, 0, sc.errorf(l, "wait takes a duration")
+			}
+			d, err := time.ParseDuration(l.args[1])
+			if err != nil || d < 0 {
+				return nil, 0, 0, sc.errorf(l, "bad duration %q", l.args[1])
+			}
+			at += d
+		case "repeat":
+			if len(l.args) != 2 {
+				return nil, 0, 0, sc.errorf(l, "repeat takes a count")
+			}
+			n, err := strconv.Atoi(l.args[1])
+			if err != nil || n < 0 {
+				return nil, 0, 0, sc.errorf(l, "bad count %q", l.args[1])
+			}
+			body, d, end, err := sc.block(i+1, 0)
+			if err != nil {
+				return nil, 0, 0, err
+			}
+			if end == len(sc.lines) {
+				return nil, 0, 0, sc.errorf(l, "repeat without end")
+			}
+			for k := 0; k < n; k++ {
+				for _, st := range body {
+					st.at += at + time.Duration(k)*d
+					steps = append(steps, st)
+				}
+			}
+			at += time.Duration(n) * d
+			i = end
+		default:
+			for _, u := range unscripted {
+				if l.args[0] == u {
+					return nil, 0, 0, sc.errorf(l, "can't %s in a script", u)
+				}
+			}
+			_, act, err := parse(shorthand(l.args), ioutil.Discard)
+			if err != nil {
+				return nil, 0, 0, sc.errorf(l, "%s: %v", l.args[0], err)
+			}
+			pos := fmt.Sprintf("%s:%d", sc.name, l.n)
+			steps = append(steps, step{at, pos, strings.Join(l.args, " "), act})
+		}
+	}
+	return steps, at, i, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScriptTimeline(t *testing.T) {
+	tl, err := readScript("s", strings.NewReader(`
+# Warm up.
+fire 3
+wait 2s
+repeat 2   # Twice.
+  kick -p 2
+  wait 500ms
+  repeat 2
+    random
+  end
+  wait 1s
+end
+gravity 0.02
+wait 1s
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var out bytes.Buffer
+	tl.print(&out)
+	want := `    0.0s  fire 3
+    2.0s  kick -p 2
+    2.5s  random
+    2.5s  random
+    3.5s  kick -p 2
+    4.0s  random
+    4.0s  random
+    5.0s  gravity 0.02
+    6.0s  done
+`
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestBadScripts(t *testing.T) {
+	for _, tc := range []struct {
+		script, want string
+	}{
+		{"fire\nwait\n", "s:2: wait takes a duration"},
+		{"wait soon", `s:1: bad duration "soon"`},
+		{"repeat 2\nfire\n", "s:1: repeat without end"},
+		{"fire\nend", "s:2: end without repeat"},
+		{"repeat x\nend", `s:1: bad count "x"`},
+		{"gravity heavy", `s:1: gravity: gravity "heavy" isn't a number`},
+		{"jump", `s:1: jump: unknown command "jump"`},
+		{"console", "s:1: can't console in a script"},
+	} {
+		_, err := readScript("s", strings.NewReader(tc.script))
+		if _, ok := err.(*usageError); !ok || err.Error() != tc.want {
+			t.Errorf("%q: got error %v, want %q", tc.script, err, tc.want)
+		}
+	}
+}
+
+func TestScriptRunsInTime(t *testing.T) {
+	tl, err := readScript("s", strings.NewReader(
+		"fire\nwait 50ms\nrepeat 2\nkick\nend\ngravity 0.5"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	nm := &fakeNetManager{}
+	start := time.Now()
+	if err := tl.run(&session{nm, &bytes.Buffer{}, false}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if took := time.Since(start); took < 50*time.Millisecond {
+		t.Errorf("took %v, want at least the wait", took)
+	}
+	want := []string{
+		"FireBall 1 everyone",
+		"DoMasterCommand kick everyone",
+		"DoMasterCommand kick everyone",
+		"SetGravity 0.5 everyone",
+	}
+	if !reflect.DeepEqual(nm.calls, want) {
+		t.Errorf("got calls %v, want %v", nm.calls, want)
+	}
+}
@@ -2,18 +2,28 @@ package model
 
 import (
 	"fmt"
+	"time"
 )
 
+// DefaultBallRadius is the radius of a new ball, as a fraction of the
+// shorter side of the screen holding it.  The screen draws balls at
+// this size, and physics uses it for collisions.
+const DefaultBallRadius = 0.06
+
 type Ball struct {
-	owner *Player
-	p     Vec
-	v     Vec
+	owner  *Player
+	p      Vec
+	v      Vec
+	radius float32
+	mass   float32
+	aspect float32
+	sentAt time.Time
 }
 
 func NewBall(
 	owner *Player,
 	p Vec, v Vec) *Ball {
-	return &Ball{owner, p, v}
+	return &Ball{owner, p, v, DefaultBallRadius, 1, 0, time.Time{}}
 }
 
 func (b *Ball) String() string {
@@ -45,14 +55,49 @@ func (b *Ball) SetVel(x float32, y float32) {
 	b.v = Vec{x, y}
 }
 
+// Radius is a fraction of the shorter side of the screen, so a ball
+// keeps its apparent size as it moves between screens.
+func (b *Ball) Radius() float32 {
+	return b.radius
+}
+
+func (b *Ball) SetRadius(r float32) {
+	b.radius = r
+}
+
+// Aspect is the width over height of the screen that the ball's
+// velocity is relative to, or zero if unknown.
+func (b *Ball) Aspect() float32 {
+	return b.aspect
+}
+
+func (b *Ball) SetAspect(a float32) {
+	b.aspect = a
+}
+
+// SentAt is when the ball was thrown to this player, by this player's
+// clock, or the zero time if unknown.
+func (b *Ball) SentAt() time.Time {
+	return b.sentAt
+}
+
+func (b *Ball) SetSentAt(t time.Time) {
+	b.sentAt = t
+}
+
+func (b *Ball) Mass() float32 {
+	return b.mass
+}
+
+func (b *Ball) SetMass(m float32) {
+	b.mass = m
+}
+
 type BallCommand struct {
 	B *Ball
 	D Direction
 }
 
 func (bc BallCommand) String() string {
-	if bc.D == Left {
-		return "toss-" + bc.B.String() + "-left"
-	}
-	return "toss-" + bc.B.String() + "-right"
+	return "toss-" + bc.B.String() + "-" + bc.D.String()
 }
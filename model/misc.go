@@ -1,5 +1,9 @@
 package model
 
+import (
+	"fmt"
+)
+
 type ExecCommand int
 
 const (
@@ -29,21 +33,97 @@ type Direction int
 const (
 	Left Direction = iota
 	Right
+	Up
+	Down
 )
 
+// Every direction a ball can leave a screen in.
+var Directions = []Direction{Left, Right, Up, Down}
+
 func (s Direction) String() string {
-	if s == Left {
+	switch s {
+	case Left:
 		return "left"
-	} else {
+	case Right:
 		return "right"
+	case Up:
+		return "up"
+	default:
+		return "down"
+	}
+}
+
+// Opposite returns the direction facing s.
+func (s Direction) Opposite() Direction {
+	switch s {
+	case Left:
+		return Right
+	case Right:
+		return Left
+	case Up:
+		return Down
+	default:
+		return Up
+	}
+}
+
+// Horizontal is true for Left and Right.
+func (s Direction) Horizontal() bool {
+	return s == Left || s == Right
+}
+
+// ClosedDoors returns a door in every direction, all closed.
+func ClosedDoors() map[Direction]DoorCommand {
+	doors := make(map[Direction]DoorCommand)
+	for _, d := range Directions {
+		doors[d] = WholeDoor(Closed, d)
 	}
+	return doors
 }
 
+// A door on the edge of a screen in direction D.  Only the part of the
+// edge from Lo to Hi opens; the rest is wall.  Lo and Hi are fractions
+// of the edge's length, measured from its left or top end.
 type DoorCommand struct {
-	S DoorState
-	D Direction
+	S  DoorState
+	D  Direction
+	Lo float32
+	Hi float32
+}
+
+// WholeDoor returns a door spanning the whole edge.
+func WholeDoor(s DoorState, d Direction) DoorCommand {
+	return DoorCommand{s, d, 0, 1}
+}
+
+// OpenAt is true if a ball reaching the edge at the given fraction of
+// its length passes through.
+func (dc DoorCommand) OpenAt(along float32) bool {
+	return dc.S == Open && along >= dc.Lo && along <= dc.Hi
 }
 
 func (dc DoorCommand) String() string {
-	return dc.S.String() + "-" + dc.D.String()
+	s := dc.S.String() + "-" + dc.D.String()
+	if dc.S == Open && (dc.Lo > 0 || dc.Hi < 1) {
+		s += fmt.Sprintf("[%.2f,%.2f]", dc.Lo, dc.Hi)
+	}
+	return s
+}
+
+// Physical size of a screen in millimetres, or zeros if unknown.
+type Dimensions struct {
+	W float32
+	H float32
+}
+
+// DimensionsOf returns the size of a screen with the given number of
+// pixels, or zeros if pixelsPerPt, as found in a size.Event, is not
+// known.
+func DimensionsOf(widthPx, heightPx, pixelsPerPt float32) Dimensions {
+	if pixelsPerPt <= 0 {
+		return Dimensions{}
+	}
+	// A point is 1/72 inch.
+	mmPerPx := 25.4 / 72 / pixelsPerPt
+	return Dimensions{widthPx * mmPerPx, heightPx * mmPerPx}
 }
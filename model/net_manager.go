@@ -1,18 +1,39 @@
 package model
 
+// Calls that reach other players return the players they failed to
+// reach as PeerErrors.  Those the master makes to many players at once
+// also return how each call went, as Results, and go to the players a
+// Target picks.  A player that fails a call is dropped from the room,
+// so one crashed device doesn't take the others down with it.
 type NetManager interface {
 	IsRunning() bool
 	GetRelay() Relay
 	GetReady() <-chan bool
 	ChDoorCommand() <-chan DoorCommand
+	// Players dropped from the room because they stopped answering.
+	ChPeerLost() <-chan *Player
 	Me() *Player
 	JoinGame(chBc <-chan BallCommand)
-	Quit(id int)
-	List()
-	FireBall(count int)
-	DoMasterCommand(c string)
-	SetPauseDuration(pd float32)
-	SetGravity(g float32)
+	// Catch up with players that joined or left, and with the room.
+	// Only the game master need call it.
+	Refresh() error
+	Quit(id int) error
+	// What the picked players that answer are up to, in player order.
+	List(t Target) ([]*State, error)
+	// Refresh, then say what every player that answers is up to, in
+	// player order, without dropping those that don't.  For watching
+	// the room; only the game master need call it.
+	Poll() ([]*State, error)
+	FireBall(count int, t Target) (Results, error)
+	DoMasterCommand(c string, t Target) (Results, error)
+	SetPauseDuration(pd float32, t Target) (Results, error)
+	SetGravity(g float32, t Target) (Results, error)
+	Room() Room
+	SetRoom(room Room) error
+	// Tell other players the physical size of this player's screen.
+	Advertise(d Dimensions)
+	// The physical size of the given player's screen, as it advertised.
+	ScreenSize(id int) (Dimensions, error)
 	NoNewBallsOrPeople()
 	Stop()
 }
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A call to another player that failed.
+type PeerError struct {
+	Player *Player
+	Op     string
+	Err    error
+}
+
+func (e *PeerError) Error() string {
+	return fmt.Sprintf("%s to player %v failed: %v", e.Op, e.Player, e.Err)
+}
+
+// The failures of a call made to several players.
+type PeerErrors []*PeerError
+
+func (pe PeerErrors) Error() string {
+	s := make([]string, len(pe))
+	for i, e := range pe {
+		s[i] = e.Error()
+	}
+	return strings.Join(s, "; ")
+}
+
+// Err returns nil if nothing failed, so that callers needn't compare
+// an interface holding an empty slice against nil.
+func (pe PeerErrors) Err() error {
+	if len(pe) == 0 {
+		return nil
+	}
+	return pe
+}
+
+// The outcome of one call to one player.
+type PeerResult struct {
+	Player *Player
+	Op     string
+	Took   time.Duration
+	Err    error // Nil if the call succeeded.
+}
+
+// The outcomes of a call made to several players, one per player, in
+// player order.
+type Results []*PeerResult
+
+// Failures returns the results that failed, as PeerErrors.
+func (rs Results) Failures() PeerErrors {
+	var errs PeerErrors
+	for _, r := range rs {
+		if r.Err != nil {
+			errs = append(errs, &PeerError{r.Player, r.Op, r.Err})
+		}
+	}
+	return errs
+}
+
+// Err returns the failures as PeerErrors, or nil if there were none.
+func (rs Results) Err() error {
+	return rs.Failures().Err()
+}
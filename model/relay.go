@@ -10,4 +10,7 @@ type Relay interface {
 	ChMasterCommand() <-chan ifc.MasterCommand
 	ChPauseDuration() <-chan float32
 	ChQuit() <-chan bool
+	// Requests for the player's state, each answered on the channel
+	// sent.
+	ChState() <-chan chan State
 }
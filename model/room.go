@@ -0,0 +1,60 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Room describes how players are arranged.
+//
+// If the room has Slots, it has a layout: each player stands where its
+// slot says, and players without a slot stand apart from everyone.
+// Otherwise players fill a grid row by row in order of id, Columns to
+// a row, or stand in a single row if Columns isn't positive.
+//
+// In a Ring, the ends of every row and column are joined, so a ball
+// leaving the rightmost player's right door enters the leftmost
+// player's left door.
+type Room struct {
+	Columns int
+	Ring    bool
+	Slots   []Slot
+}
+
+// Slot is where a player's screen sits, and how big it is, in
+// millimetres.  X and Y are of the upper left corner, with Y growing
+// downward, as on a screen.
+type Slot struct {
+	Id int
+	X  float32
+	Y  float32
+	W  float32
+	H  float32
+}
+
+func (s Slot) String() string {
+	return fmt.Sprintf("%d: %gx%g at (%g, %g)", s.Id, s.W, s.H, s.X, s.Y)
+}
+
+// Slot returns the slot of the given player, and false if it has none.
+func (r Room) Slot(id int) (Slot, bool) {
+	for _, s := range r.Slots {
+		if s.Id == id {
+			return s, true
+		}
+	}
+	return Slot{}, false
+}
+
+func (r Room) String() string {
+	s := "one row"
+	if len(r.Slots) > 0 {
+		s = strconv.Itoa(len(r.Slots)) + " slots"
+	} else if r.Columns > 0 {
+		s = strconv.Itoa(r.Columns) + " columns"
+	}
+	if r.Ring {
+		s += ", ring"
+	}
+	return s
+}
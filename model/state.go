@@ -0,0 +1,19 @@
+package model
+
+import (
+	"time"
+)
+
+// What a player is up to, as the master sees it.  Ball positions are
+// fractions of the screen's width and height, and Gravity is the
+// change in velocity per sixtieth of a second, as set by the master.
+type State struct {
+	Player        *Player
+	Balls         []*Ball
+	Doors         []DoorCommand
+	Gravity       float32
+	PauseDuration float32
+	Size          Dimensions
+	Uptime        time.Duration
+	Version       string
+}
@@ -0,0 +1,71 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Target picks the players a master call is for: those with the given
+// ids or in the given range of ids, if either is given, that stand in
+// the given half of the room, if one is; see topology.Picks.  The zero
+// Target picks everyone.
+type Target struct {
+	Ids []int
+	// With Hi, a range of ids, inclusive; none if Hi is zero.
+	Lo   int
+	Hi   int
+	Half Half
+}
+
+// Everyone is the Target that picks every player.
+var Everyone = Target{}
+
+// A half of the room, as seen from the front.
+type Half int
+
+const (
+	Whole Half = iota
+	LeftHalf
+	RightHalf
+)
+
+func (h Half) String() string {
+	switch h {
+	case LeftHalf:
+		return "left half"
+	case RightHalf:
+		return "right half"
+	}
+	return "whole room"
+}
+
+// PicksId is true if the target picks the player with the given id,
+// wherever it stands.
+func (t Target) PicksId(id int) bool {
+	if len(t.Ids) == 0 && t.Hi == 0 {
+		return true
+	}
+	for _, n := range t.Ids {
+		if n == id {
+			return true
+		}
+	}
+	return t.Hi != 0 && t.Lo <= id && id <= t.Hi
+}
+
+func (t Target) String() string {
+	var s []string
+	if len(t.Ids) > 0 {
+		s = append(s, fmt.Sprintf("players %v", t.Ids))
+	}
+	if t.Hi != 0 {
+		s = append(s, fmt.Sprintf("players %d-%d", t.Lo, t.Hi))
+	}
+	if t.Half != Whole {
+		s = append(s, t.Half.String())
+	}
+	if len(s) == 0 {
+		return "everyone"
+	}
+	return strings.Join(s, ", ")
+}
@@ -0,0 +1,180 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+	"v.io/v23"
+	"v.io/v23/context"
+	"v.io/v23/security"
+	"v.io/v23/security/access"
+	"v.io/v23/services/mounttable"
+	"v.io/v23/verror"
+)
+
+// Returned by a claimer when another player already holds the name.
+var errNameTaken = errors.New("name already claimed")
+
+// A claimer hands out player names.  Player ids are never chosen by
+// looking alone; an id is only ours once claim says so.
+type claimer interface {
+	// Ids of the players currently holding names, in any order.
+	ids() ([]int, error)
+	// Claim the name of the given player id.  Claims must be atomic:
+	// of several joiners claiming one id at once, exactly one wins,
+	// and every other gets errNameTaken.
+	claim(id int) error
+}
+
+const (
+	maxClaimAttempts = 20
+	maxClaimBackoff  = 50 * time.Millisecond
+	// How long a claimed name may go without a server mounted on it
+	// before it's taken for the claim of a player that died.  Long
+	// enough for a joiner to get from claiming to serving, and for the
+	// mount of a player that died to run out.
+	claimGrace = 30 * time.Second
+)
+
+// Pick an id one above every id in use, and claim it.  If someone else
+// got there first, wait a random moment so the losers spread out, and
+// try again further up.  Returns the claimed id, and the ids of the
+// other players as seen after the claim.
+//
+// Listing after claiming means that of any two joiners racing each
+// other, the second to claim sees the first, and says hello to it.
+func allocateId(c claimer, chatty bool) (int, []int, error) {
+	floor := 1
+	for attempt := 0; attempt < maxClaimAttempts; attempt++ {
+		ids, err := c.ids()
+		if err != nil {
+			return 0, nil, err
+		}
+		id := floor
+		for _, n := range ids {
+			if n >= id {
+				id = n + 1
+			}
+		}
+		err = c.claim(id)
+		if err == nil {
+			others, err := c.ids()
+			if err != nil {
+				return 0, nil, err
+			}
+			return id, without(others, id), nil
+		}
+		if err != errNameTaken {
+			return 0, nil, err
+		}
+		if chatty {
+			log.Printf("Lost the race for player %d, trying again.", id)
+		}
+		floor = id + 1
+		time.Sleep(time.Duration(rand.Int63n(int64(maxClaimBackoff))))
+	}
+	return 0, nil, fmt.Errorf(
+		"unable to claim a player id in %d attempts", maxClaimAttempts)
+}
+
+// Sorted copy of ids, minus the given id.
+func without(ids []int, id int) []int {
+	result := []int{}
+	for _, n := range ids {
+		if n != id {
+			result = append(result, n)
+		}
+	}
+	sort.Ints(result)
+	return result
+}
+
+// Claims names in the mounttable.
+//
+// A mounttable node starts life at permissions version "0", and setting
+// permissions at a given version is a compare-and-swap.  So of several
+// players setting permissions on a fresh name at version "0", only the
+// first succeeds; the others get ErrBadVersion.  The node outlives the
+// server mounted on it, so a name stays claimed until released, or
+// until it has gone claimGrace without a server; then it's deleted,
+// and free to be claimed again.
+type mtClaimer struct {
+	t *V23Transport
+}
+
+func (c *mtClaimer) ids() ([]int, error) {
+	return c.t.playerNumbers()
+}
+
+func (c *mtClaimer) claim(id int) error {
+	ctx, cancel := context.WithTimeout(c.t.ctx, time.Minute)
+	defer cancel()
+	err := v23.GetNamespace(ctx).SetPermissions(
+		ctx, c.t.serverName(id), openPermissions(), "0")
+	if verror.ErrorID(err) == verror.ErrBadVersion.ID {
+		return errNameTaken
+	}
+	return err
+}
+
+// Give up the name claimed for the given id.
+func (c *mtClaimer) release(id int) error {
+	ctx, cancel := context.WithTimeout(c.t.ctx, time.Minute)
+	defer cancel()
+	return v23.GetNamespace(ctx).Delete(ctx, c.t.serverName(id), true)
+}
+
+// Tells the names of players that died from those of players that
+// have only just claimed them, and haven't mounted their servers yet.
+type unmountedClaims struct {
+	mu    sync.Mutex
+	grace time.Duration
+	now   func() time.Time
+	since map[int]time.Time // When each id was first seen unmounted.
+}
+
+func newUnmountedClaims() *unmountedClaims {
+	return &unmountedClaims{
+		sync.Mutex{}, claimGrace, time.Now, make(map[int]time.Time)}
+}
+
+// Whether the claim on the given id, seen with or without a server
+// mounted, has gone unmounted for longer than the grace period.
+func (u *unmountedClaims) abandoned(id int, mounted bool) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if mounted {
+		delete(u.since, id)
+		return false
+	}
+	first, ok := u.since[id]
+	if !ok {
+		u.since[id] = u.now()
+		return false
+	}
+	if u.now().Sub(first) <= u.grace {
+		return false
+	}
+	delete(u.since, id)
+	return true
+}
+
+// Claims keep players from colliding by accident; they aren't meant to
+// keep anyone out.
+func openPermissions() access.Permissions {
+	perms := access.Permissions{}
+	for _, tag := range []mounttable.Tag{
+		mounttable.Admin,
+		mounttable.Mount,
+		mounttable.Read,
+		mounttable.Resolve,
+		mounttable.Create,
+	} {
+		perms.Add(security.AllPrincipals, string(tag))
+	}
+	return perms
+}
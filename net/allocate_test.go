@@ -0,0 +1,196 @@
+package net
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Stands in for a mounttable: claims are atomic, listings are not, and
+// both take a moment so that joiners interleave.
+type fakeTable struct {
+	mu     sync.Mutex
+	names  map[int]bool
+	claims int
+}
+
+func newFakeTable() *fakeTable {
+	return &fakeTable{names: make(map[int]bool)}
+}
+
+func dawdle() {
+	time.Sleep(time.Duration(rand.Int63n(int64(time.Millisecond))))
+}
+
+func (ft *fakeTable) ids() ([]int, error) {
+	dawdle()
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	ids := []int{}
+	for id := range ft.names {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (ft *fakeTable) claim(id int) error {
+	dawdle()
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	ft.claims++
+	if ft.names[id] {
+		return errNameTaken
+	}
+	ft.names[id] = true
+	return nil
+}
+
+type joined struct {
+	id     int
+	others []int
+	err    error
+}
+
+func joinAtOnce(c claimer, count int) []joined {
+	result := make([]joined, count)
+	var start, done sync.WaitGroup
+	start.Add(1)
+	for i := range result {
+		done.Add(1)
+		go func(j *joined) {
+			defer done.Done()
+			start.Wait()
+			j.id, j.others, j.err = allocateId(c, false)
+		}(&result[i])
+	}
+	start.Done()
+	done.Wait()
+	return result
+}
+
+func contains(ids []int, id int) bool {
+	for _, n := range ids {
+		if n == id {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAllocateIdAlone(t *testing.T) {
+	ft := newFakeTable()
+	ft.names[3] = true
+	ft.names[7] = true
+	id, others, err := allocateId(ft, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id != 8 {
+		t.Errorf("got id %d, want 8", id)
+	}
+	if len(others) != 2 || others[0] != 3 || others[1] != 7 {
+		t.Errorf("got others %v, want [3 7]", others)
+	}
+}
+
+func TestConcurrentJoinersGetDistinctIds(t *testing.T) {
+	const count = 40
+	ft := newFakeTable()
+	result := joinAtOnce(ft, count)
+	seen := make(map[int]bool)
+	for _, j := range result {
+		if j.err != nil {
+			t.Fatalf("joiner failed: %v", j.err)
+		}
+		if seen[j.id] {
+			t.Errorf("id %d handed out twice", j.id)
+		}
+		seen[j.id] = true
+		if contains(j.others, j.id) {
+			t.Errorf("player %d counts itself among the others", j.id)
+		}
+	}
+	if len(ft.names) != count {
+		t.Errorf("table holds %d names, want %d", len(ft.names), count)
+	}
+	t.Logf("%d joiners needed %d claims", count, ft.claims)
+}
+
+// Players only learn of each other by one saying hello to the other,
+// so of every two racing joiners at least one must see the other.
+func TestConcurrentJoinersSeeEachOther(t *testing.T) {
+	result := joinAtOnce(newFakeTable(), 25)
+	for i, a := range result {
+		for _, b := range result[i+1:] {
+			if !contains(a.others, b.id) && !contains(b.others, a.id) {
+				t.Errorf("players %d and %d never see each other", a.id, b.id)
+			}
+		}
+	}
+}
+
+// A table where every claim fails.
+type fullTable struct{}
+
+func (fullTable) ids() ([]int, error) { return []int{}, nil }
+func (fullTable) claim(id int) error  { return errNameTaken }
+
+func TestAllocateIdGivesUp(t *testing.T) {
+	if _, _, err := allocateId(fullTable{}, false); err == nil {
+		t.Errorf("expected an error from a table that refuses every claim")
+	}
+}
+
+// A table that can't be reached, so can't say who holds what.
+type unreachableTable struct {
+	claims int
+}
+
+func (ut *unreachableTable) ids() ([]int, error) {
+	return nil, errors.New("mounttable unreachable")
+}
+
+func (ut *unreachableTable) claim(id int) error {
+	ut.claims++
+	return nil
+}
+
+func TestAllocateIdFailsIfTableUnreadable(t *testing.T) {
+	ut := &unreachableTable{}
+	if _, _, err := allocateId(ut, false); err == nil {
+		t.Errorf("expected an error from a table that can't be read")
+	}
+	if ut.claims != 0 {
+		t.Errorf("claimed %d names without knowing who holds what", ut.claims)
+	}
+}
+
+func TestClaimsUnmountedPastGraceAreAbandoned(t *testing.T) {
+	u := newUnmountedClaims()
+	now := time.Unix(0, 0)
+	u.now = func() time.Time { return now }
+
+	// Player 1 serves; 2 has just claimed; 3 died.
+	for _, id := range []int{2, 3} {
+		if u.abandoned(id, false) {
+			t.Errorf("player %d abandoned on first sight", id)
+		}
+	}
+	now = now.Add(claimGrace / 2)
+	if u.abandoned(1, true) || u.abandoned(2, true) || u.abandoned(3, false) {
+		t.Errorf("claims abandoned within the grace period")
+	}
+	now = now.Add(claimGrace/2 + time.Second)
+	if u.abandoned(1, true) || u.abandoned(2, true) {
+		t.Errorf("serving players taken for dead")
+	}
+	if !u.abandoned(3, false) {
+		t.Errorf("player 3 kept its claim past the grace period")
+	}
+	// Once released, a fresh claim on the id gets the grace period again.
+	if u.abandoned(3, false) {
+		t.Errorf("a fresh claim on 3 was abandoned on first sight")
+	}
+}
@@ -1,10 +0,0 @@
-package net
-
-import (
-	"testing"
-)
-
-func TestFindMt(t *testing.T) {
-	ns := DetermineNamespaceRoot()
-	t.Logf("ns = \"%s\"", ns)
-}
@@ -0,0 +1,373 @@
+// V23Transport connects players with v23 RPCs.
+//
+// Each player has an embedded V23 service, and is a direct client to
+// the V23 services held by all the other players.  Players find each
+// other via a mounttable, where each claims a name holding its id.
+
+package net
+
+import (
+	"errors"
+	"fmt"
+	"github.com/monopole/volley/config"
+	"github.com/monopole/volley/discovery"
+	"github.com/monopole/volley/ifc"
+	"github.com/monopole/volley/peer"
+	"github.com/monopole/volley/relay"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"v.io/v23"
+	"v.io/v23/context"
+	"v.io/v23/naming"
+	"v.io/v23/options"
+	"v.io/v23/rpc"
+	"v.io/v23/security"
+	_ "v.io/x/ref/runtime/factories/generic"
+	"v.io/x/ref/services/mounttable/mounttablelib"
+)
+
+// How long a call to another player may take, but for pings, which
+// say how long.
+const callTimeout = 5 * time.Second
+
+type V23Transport struct {
+	chatty         bool
+	ctx            *context.T
+	shutdown       v23.Shutdown
+	isGameMaster   bool
+	rootName       string
+	namespaceRoot  string
+	hostsNamespace bool              // Runs the mounttable.
+	stopMountTable func()            // Nil unless hosting.
+	beacon         *discovery.Beacon // Announces namespaceRoot.
+	rpcOpts        rpc.CallOpt
+	myId           int              // Claimed by Join.
+	unmounted      *unmountedClaims // Claims found without a server.
+}
+
+func NewV23Transport(
+	chatty bool,
+	rootName string,
+	isGameMaster bool,
+	namespaceRoot string,
+	hostsNamespace bool) *V23Transport {
+	return &V23Transport{
+		chatty,
+		nil, // ctx
+		nil, // shutdown
+		isGameMaster,
+		rootName,
+		namespaceRoot,
+		hostsNamespace,
+		nil, // stopMountTable
+		nil, // beacon
+		options.ServerAuthorizer{security.AllowEveryone()},
+		0, // myId
+		newUnmountedClaims(),
+	}
+}
+
+// NewV23Manager returns a manager for a player reaching the others
+// with v23 RPCs.
+func NewV23Manager(
+	chatty bool,
+	rootName string,
+	isGameMaster bool,
+	namespaceRoot string,
+	hostsNamespace bool) *peer.Manager {
+	return peer.NewManager(chatty, isGameMaster,
+		NewV23Transport(
+			chatty, rootName, isGameMaster, namespaceRoot, hostsNamespace))
+}
+
+func gotNetwork() bool {
+	_, err := http.Get(config.TestDomain)
+	if err == nil {
+		log.Printf("Network up - able to hit %s", config.TestDomain)
+		return true
+	}
+	log.Printf("Something wrong with network: %v", err)
+	return false
+}
+
+func (t *V23Transport) Open() error {
+	if config.FailFast && !gotNetwork() {
+		return errors.New("no network")
+	}
+	if t.chatty {
+		log.Printf("Calling v23.Init")
+	}
+	t.ctx, t.shutdown = v23.Init()
+	if t.shutdown == nil {
+		log.Panic("shutdown nil")
+	}
+	if t.hostsNamespace {
+		if err := t.hostNamespace(); err != nil {
+			return fmt.Errorf("unable to host the namespace: %v", err)
+		}
+	}
+	if t.chatty {
+		log.Printf("Setting root to %v", t.namespaceRoot)
+	}
+	v23.GetNamespace(t.ctx).SetRoots(t.namespaceRoot)
+	return nil
+}
+
+// Run a mounttable in this process, and announce it at once, as
+// players may be waiting for it.  The namespace root is this host's,
+// at config.MountTablePort; see discovery.DetermineRoot.
+func (t *V23Transport) hostNamespace() error {
+	spec := rpc.ListenSpec{
+		Addrs: rpc.ListenAddrs{{"tcp", ":" + config.MountTablePort}}}
+	name, stop, err := mounttablelib.StartServers(
+		t.ctx, spec, "", "", "", "", "mounttable")
+	if err != nil {
+		return err
+	}
+	if t.chatty {
+		log.Printf("Mounttable running at %s", name)
+	}
+	t.stopMountTable = stop
+	t.announceRoot()
+	return nil
+}
+
+// Having reached the mounttable, remember where it is, and tell
+// players yet to find it.
+func (t *V23Transport) announceRoot() {
+	b, err := discovery.Publish(
+		strings.TrimPrefix(t.namespaceRoot, "/"), t.isGameMaster)
+	if err != nil {
+		log.Printf("Unable to announce namespace root: %v", err)
+		return
+	}
+	t.beacon = b
+}
+
+func (t *V23Transport) List() ([]int, error) {
+	return t.playerNumbers()
+}
+
+func (t *V23Transport) Join(r *relay.Relay) (int, []int, error) {
+	id, others, err := allocateId(&mtClaimer{t}, t.chatty)
+	if err != nil {
+		return 0, nil, fmt.Errorf("unable to claim a player name: %v", err)
+	}
+	t.myId = id
+	myName := t.serverName(id)
+	if t.chatty {
+		log.Printf("Calling myself %s\n", myName)
+	}
+	ctx, s, err := v23.WithNewServer(
+		t.ctx, myName, ifc.GameServiceServer(r), MakeAuthorizer())
+	if err != nil {
+		return 0, nil, fmt.Errorf("error creating server: %v", err)
+	}
+	saveEndpointToFile(s)
+	t.ctx = ctx
+	if t.beacon == nil {
+		t.announceRoot()
+	}
+	return id, others, nil
+}
+
+func (t *V23Transport) Leave() error {
+	c := &mtClaimer{t}
+	return c.release(t.myId)
+}
+
+func (t *V23Transport) Dial(id int) peer.Peer {
+	return &v23Peer{t, ifc.GameServiceClient(t.serverName(id))}
+}
+
+func (t *V23Transport) Close() {
+	if t.beacon != nil {
+		t.beacon.Stop()
+	}
+	if t.stopMountTable != nil {
+		t.stopMountTable()
+	}
+	if t.chatty {
+		log.Println("v23 calling native shutdown.")
+	}
+	t.shutdown()
+}
+
+// A context for one call to another player.  Calls are bounded, so a
+// player that hangs fails calls, and is evicted, rather than stalling
+// everyone calling it.
+func (t *V23Transport) callContext() (*context.T, context.CancelFunc) {
+	return context.WithTimeout(t.ctx, callTimeout)
+}
+
+func (t *V23Transport) serverName(n int) string {
+	return t.rootName + fmt.Sprintf("%04d", n)
+}
+
+// Return array of known players.  Fails if the mounttable can't be
+// read, rather than claim there's nobody about.  Names abandoned by
+// players that died are deleted, and left out.
+func (t *V23Transport) playerNumbers() ([]int, error) {
+	list := []int{}
+	dead := []int{}
+	rCtx, cancel := context.WithTimeout(t.ctx, time.Minute)
+	defer cancel()
+	if t.chatty {
+		log.Printf("Recovering namespace.")
+	}
+	ns := v23.GetNamespace(rCtx)
+	if t.chatty {
+		log.Printf("namespace == %T %v", ns, ns)
+	}
+	pattern := t.rootName + "*"
+	if t.chatty {
+		log.Printf("Calling glob with %T=%v, pattern=%v\n",
+			rCtx, rCtx, pattern)
+	}
+	c, err := ns.Glob(rCtx, pattern)
+	if err != nil {
+		return nil, fmt.Errorf("ns.Glob(%v) failed: %v", pattern, err)
+	}
+	if t.chatty {
+		log.Printf("Awaiting response from Glob request.")
+	}
+	for res := range c {
+		if t.chatty {
+			log.Printf("Got a result: %v\n", res)
+		}
+		switch v := res.(type) {
+		case *naming.GlobReplyEntry:
+			name := v.Value.Name
+			if t.chatty {
+				log.Printf("Raw name is: %v\n", name)
+			}
+			if name != "" {
+				putativeNumber := name[len(t.rootName):]
+				n, err := strconv.ParseInt(putativeNumber, 10, 32)
+				if err != nil {
+					log.Println(err)
+				} else if t.unmounted.abandoned(
+					int(n), len(v.Value.Servers) > 0) {
+					dead = append(dead, int(n))
+				} else {
+					list = append(list, int(n))
+				}
+				if t.chatty {
+					log.Println("Found player: ", v.Value.Name)
+				}
+			}
+		case *naming.GlobReplyError:
+			err = fmt.Errorf("ns.Glob(%v) failed at %q: %v",
+				pattern, v.Value.Name, v.Value.Error)
+		default:
+		}
+	}
+	if err != nil {
+		// The channel is drained, so the glob is done with.
+		return nil, err
+	}
+	if t.chatty {
+		log.Printf("Finished processing glob response.")
+	}
+	claims := &mtClaimer{t}
+	for _, n := range dead {
+		log.Printf("Player %d stopped serving long ago; releasing its name.", n)
+		if err := claims.release(n); err != nil {
+			log.Printf("Unable to release player %d: %v", n, err)
+		}
+	}
+	return list, nil
+}
+
+// A player as reached through its v23 service.
+type v23Peer struct {
+	t *V23Transport
+	c ifc.GameServiceClientStub
+}
+
+func (p *v23Peer) Recognize(wp ifc.Player) error {
+	ctx, cancel := p.t.callContext()
+	defer cancel()
+	return p.c.Recognize(ctx, wp, p.t.rpcOpts)
+}
+
+func (p *v23Peer) Forget(wp ifc.Player) error {
+	ctx, cancel := p.t.callContext()
+	defer cancel()
+	return p.c.Forget(ctx, wp, p.t.rpcOpts)
+}
+
+func (p *v23Peer) Accept(b ifc.Ball) error {
+	ctx, cancel := p.t.callContext()
+	defer cancel()
+	return p.c.Accept(ctx, b, p.t.rpcOpts)
+}
+
+func (p *v23Peer) Deposit(b ifc.Ball) error {
+	ctx, cancel := p.t.callContext()
+	defer cancel()
+	return p.c.Deposit(ctx, b, p.t.rpcOpts)
+}
+
+func (p *v23Peer) Quit() error {
+	ctx, cancel := p.t.callContext()
+	defer cancel()
+	return p.c.Quit(ctx, p.t.rpcOpts)
+}
+
+func (p *v23Peer) Now() (int64, error) {
+	ctx, cancel := p.t.callContext()
+	defer cancel()
+	return p.c.Now(ctx, p.t.rpcOpts)
+}
+
+func (p *v23Peer) Ping(wait time.Duration) error {
+	ctx, cancel := context.WithTimeout(p.t.ctx, wait)
+	defer cancel()
+	return p.c.Ping(ctx, p.t.rpcOpts)
+}
+
+func (p *v23Peer) DoMasterCommand(mc ifc.MasterCommand) error {
+	ctx, cancel := p.t.callContext()
+	defer cancel()
+	return p.c.DoMasterCommand(ctx, mc, p.t.rpcOpts)
+}
+
+func (p *v23Peer) SetPauseDuration(pd float32) error {
+	ctx, cancel := p.t.callContext()
+	defer cancel()
+	return p.c.SetPauseDuration(ctx, pd, p.t.rpcOpts)
+}
+
+func (p *v23Peer) SetGravity(g float32) error {
+	ctx, cancel := p.t.callContext()
+	defer cancel()
+	return p.c.SetGravity(ctx, g, p.t.rpcOpts)
+}
+
+func (p *v23Peer) SetRoom(wr ifc.Room) error {
+	ctx, cancel := p.t.callContext()
+	defer cancel()
+	return p.c.SetRoom(ctx, wr, p.t.rpcOpts)
+}
+
+func (p *v23Peer) GetRoom() (ifc.Room, error) {
+	ctx, cancel := p.t.callContext()
+	defer cancel()
+	return p.c.GetRoom(ctx, p.t.rpcOpts)
+}
+
+func (p *v23Peer) GetSize() (ifc.Size, error) {
+	ctx, cancel := p.t.callContext()
+	defer cancel()
+	return p.c.GetSize(ctx, p.t.rpcOpts)
+}
+
+func (p *v23Peer) GetState() (ifc.State, error) {
+	ctx, cancel := p.t.callContext()
+	defer cancel()
+	return p.c.GetState(ctx, p.t.rpcOpts)
+}
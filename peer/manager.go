@@ -0,0 +1,1036 @@
+// Package peer connects a player to the other players.
+//
+// Each device/game/program instance must have one Manager.
+//
+// The Manager keeps track of the other players, decides which doors
+// are open, and hands balls and commands to the others.  How it
+// reaches them is up to its Transport.
+//
+// On startup, the manager asks the transport for a player id and the
+// ids of the other players, fires off go routines to manage data
+// coming in on various channels, and establishes contact with the
+// other players.
+package peer
+
+import (
+	"errors"
+	"fmt"
+	"github.com/monopole/volley/ifc"
+	"github.com/monopole/volley/model"
+	"github.com/monopole/volley/relay"
+	"github.com/monopole/volley/topology"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The game master takes no id from the transport, and goes by this one.
+const MasterId = 999
+
+// Why a player that was missing pings was dropped, when another player
+// gave up on it first.
+var errForgotten = errors.New("forgotten by another player")
+
+type remote struct {
+	p *model.Player
+	c Peer
+	// How far the player's clock is ahead of ours.
+	offset time.Duration
+	// Pings unanswered in a row.
+	misses int
+	// True while a ping is out.
+	pinging bool
+}
+
+// The result of pinging a player.
+type pong struct {
+	p   *model.Player
+	err error
+}
+
+// How far a player's clock is ahead of ours.
+type clockOffset struct {
+	p      *model.Player
+	offset time.Duration
+}
+
+const (
+	// Number of clock readings taken when estimating a clock offset.
+	clockSamples = 3
+	// How often a player checks that its neighbors are alive.
+	defaultPingInterval = time.Second
+	// How long a neighbor has to answer a ping.
+	pingTimeout = 2 * time.Second
+	// Pings missed in a row before a neighbor is given up for dead.
+	maxMissedPings = 3
+	// Rounds of pings between looks for dropped players still about.
+	relistPings = 5
+	// Lost players the engine may fall behind on hearing about.
+	peerLostBacklog = 8
+	// Time between rounds of balls fired at once.
+	fireInterval = 100 * time.Millisecond
+)
+
+type Manager struct {
+	chatty               bool
+	transport            Transport
+	isRunning            bool
+	isGameMaster         bool
+	doors                map[model.Direction]model.DoorCommand
+	room                 model.Room
+	relay                *relay.Relay
+	myself               *model.Player
+	players              []*remote
+	initialPlayerNumbers []int
+	pingInterval         time.Duration
+	chBallCommand        <-chan model.BallCommand // Not owned, read from.
+	chStop               chan chan bool           // Owned, read from.
+	chNoNewBallsOrPeople chan chan bool           // Owned, read from.
+	chDoorCommand        chan model.DoorCommand   // Owned, written to.
+	doorQueue            []model.DoorCommand      // Awaiting the engine.
+	chPeerLost           chan *model.Player       // Owned, written to.
+	chPong               chan pong                // Owned, read from.
+	chComeback           chan []int               // Owned, read from.
+	chOffset             chan clockOffset         // Owned, read from.
+	chCalled             chan model.Results       // Owned, read from.
+	relisting            bool                     // Looking for comebacks.
+	isLeaving            bool                     // Giving up the id.
+	chDone               chan bool                // Closed on stop.
+	mu                   *sync.RWMutex
+	isReady              bool
+}
+
+func NewManager(
+	chatty bool,
+	isGameMaster bool,
+	transport Transport) *Manager {
+	return &Manager{
+		chatty,
+		transport,
+		false,        // isRunning
+		isGameMaster, // isGameMaster
+		model.ClosedDoors(),
+		model.Room{},
+		nil, // relay
+		nil, // myself
+		[]*remote{},
+		nil, // initialPlayerNumbers
+		defaultPingInterval,
+		nil,                  // chBallCommands
+		make(chan chan bool), // chStop
+		make(chan chan bool), // chNoNewBallsOrPeople
+		make(chan model.DoorCommand),
+		[]model.DoorCommand{}, // doorQueue
+		make(chan *model.Player, peerLostBacklog),
+		make(chan pong),
+		make(chan []int), // chComeback
+		make(chan clockOffset),
+		make(chan model.Results), // chCalled
+		false,                    // relisting
+		false,                    // isLeaving
+		make(chan bool),          // chDone
+		new(sync.RWMutex),
+		false,
+	}
+}
+
+// SetPingInterval changes how often neighbors are pinged, which with
+// maxMissedPings decides how soon a silent one is given up for dead.
+// Call it before JoinGame.
+func (nm *Manager) SetPingInterval(d time.Duration) {
+	nm.pingInterval = d
+}
+
+func (nm *Manager) IsRunning() bool {
+	return nm.isRunning
+}
+
+// GetReady returns a bool channel.  The channel will get one datum
+// during it's life.  If the datum is true, the manager is ready to
+// join the game.  If the datum is false, the manager will never be
+// ready within the contraints of its own timeouts.  The client can
+// call this multiple times, but parallel calls block till this
+// finishes.
+func (nm *Manager) GetReady() <-chan bool {
+	nm.mu.Lock()
+	ch := make(chan bool)
+	if nm.isReady {
+		go func() {
+			ch <- true
+		}()
+		nm.mu.Unlock()
+		return ch
+	}
+	go nm.getReadyToRun(ch)
+	return ch
+}
+
+func (nm *Manager) getReadyToRun(ch chan bool) {
+	defer nm.mu.Unlock()
+	if err := nm.transport.Open(); err != nil {
+		log.Printf("Unable to open transport: %v", err)
+		ch <- false
+		return
+	}
+	nm.relay = relay.MakeRelay()
+	if nm.isGameMaster {
+		ids, err := nm.transport.List()
+		if err != nil {
+			log.Printf("Unable to list players: %v", err)
+			ch <- false
+			return
+		}
+		sort.Ints(ids)
+		nm.initialPlayerNumbers = ids
+		nm.myself = model.NewPlayer(MasterId)
+		if nm.chatty {
+			log.Printf("I am game master, and see %d players.", len(ids))
+		}
+		nm.isReady = true
+		ch <- true
+		return
+	}
+	id, others, err := nm.transport.Join(nm.relay)
+	if err != nil {
+		log.Printf("Unable to join: %v", err)
+		ch <- false
+		return
+	}
+	nm.myself = model.NewPlayer(id)
+	nm.initialPlayerNumbers = others
+	if nm.chatty {
+		log.Printf("I am player %v, and see %d others.\n", nm.myself, len(others))
+	}
+	nm.isReady = true
+	ch <- true
+}
+
+func (nm *Manager) ChDoorCommand() <-chan model.DoorCommand {
+	return nm.chDoorCommand
+}
+
+func (nm *Manager) ChPeerLost() <-chan *model.Player {
+	return nm.chPeerLost
+}
+
+func (nm *Manager) GetRelay() model.Relay {
+	return nm.relay
+}
+
+func (nm *Manager) Me() *model.Player {
+	return nm.myself
+}
+
+func (nm *Manager) recognizeOther(p *model.Player) {
+	if nm.chatty {
+		log.Printf("I (%v) am recognizing %v.", nm.Me(), p)
+	}
+	if nm.findPlayer(p.Id()) != nil {
+		return
+	}
+	rp := &remote{p, nm.transport.Dial(p.Id()), 0, 0, false}
+	if !nm.isGameMaster {
+		// The master doesn't throw balls, so doesn't care.  Reading a
+		// slow player's clock mustn't hold up the run loop, so balls
+		// thrown meanwhile go unstamped.
+		go func() {
+			offset, ok := nm.measureOffset(rp.p, rp.c)
+			if !ok {
+				return
+			}
+			select {
+			case nm.chOffset <- clockOffset{rp.p, offset}:
+			case <-nm.chDone:
+			}
+		}()
+	}
+
+	// Keep the player list sorted.
+	k := nm.findInsertion(p)
+	nm.players = append(nm.players, nil)
+	copy(nm.players[k+1:], nm.players[k:])
+	nm.players[k] = rp
+
+	if nm.chatty {
+		log.Printf("I (%v) recognize %v.", nm.Me(), p)
+	}
+	if nm.isRunning {
+		nm.checkDoors()
+	} else {
+		if nm.chatty {
+			log.Printf("Not running, so not checking doors post recog.")
+		}
+	}
+}
+
+// Estimate how far player p's clock is ahead of ours, believing the
+// reading with the shortest round trip.  The bool is false if the
+// clock couldn't be read.
+func (nm *Manager) measureOffset(
+	p *model.Player, c Peer) (offset time.Duration, ok bool) {
+	best := time.Duration(math.MaxInt64)
+	for i := 0; i < clockSamples; i++ {
+		t0 := time.Now()
+		then, err := c.Now()
+		rtt := time.Since(t0)
+		if err != nil {
+			log.Printf("Unable to read clock of %v; err=%v", p, err)
+			return 0, false
+		}
+		if rtt < best {
+			best = rtt
+			offset = time.Unix(0, then).Sub(t0.Add(rtt / 2))
+		}
+	}
+	if nm.chatty {
+		log.Printf("Clock of %v is %v ahead of mine (rtt %v).",
+			p, offset, best)
+	}
+	return offset, true
+}
+
+// Return index k of insertion point for the given player, given
+// players sorted by Id.  The player currently at k-1 is on the 'left'
+// of the argument, while the player at k is on the 'right'.  To
+// insert, right-shift elements at k and above.
+func (nm *Manager) findInsertion(p *model.Player) int {
+	for k, member := range nm.players {
+		if p.Id() < member.p.Id() {
+			return k
+		}
+	}
+	return len(nm.players)
+}
+
+func (nm *Manager) findPlayerIndex(p *model.Player) int {
+	return findIndex(len(nm.players),
+		func(i int) bool { return nm.players[i].p.Id() == p.Id() })
+}
+
+func (nm *Manager) findPlayer(id int) *remote {
+	for _, rp := range nm.players {
+		if rp.p.Id() == id {
+			return rp
+		}
+	}
+	return nil
+}
+
+func findIndex(limit int, predicate func(i int) bool) int {
+	for i := 0; i < limit; i++ {
+		if predicate(i) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (nm *Manager) forgetOther(p *model.Player) {
+	i := nm.findPlayerIndex(p)
+	if i > -1 {
+		if nm.chatty {
+			log.Printf("Me=(%v) forgetting %v.\n", nm.Me(), p)
+		}
+		if nm.players[i].misses > 0 {
+			// Pings were failing here too, so it was lost rather than
+			// said goodbye, whoever gave up on it first.
+			nm.evict(&model.PeerError{p, "Ping", errForgotten})
+			return
+		}
+		nm.players = append(nm.players[:i], nm.players[i+1:]...)
+	} else {
+		if nm.chatty {
+			log.Printf("Asked to forget %v, but don't know him\n.", p)
+		}
+	}
+	nm.checkDoors()
+}
+
+func (nm *Manager) checkDoors() {
+	if nm.chatty {
+		log.Printf("Checking doors.\n")
+	}
+	for _, dc := range topology.Doors(nm.room, nm.Me().Id(), nm.playerIds()) {
+		nm.assureDoor(dc)
+	}
+	if nm.chatty {
+		log.Println("Current players: ", nm.playersString())
+	}
+}
+
+func (nm *Manager) playerIds() []int {
+	ids := make([]int, len(nm.players))
+	for i, rp := range nm.players {
+		ids[i] = rp.p.Id()
+	}
+	return ids
+}
+
+func (nm *Manager) playersString() (s string) {
+	k := nm.findInsertion(nm.myself)
+	s = ""
+	for i := 0; i < k; i++ {
+		s += nm.players[i].p.String() + " "
+	}
+	if nm.doors[model.Left].S == model.Open {
+		s += "_"
+	} else {
+		s += "["
+	}
+	s += nm.myself.String()
+	if nm.doors[model.Right].S == model.Open {
+		s += "_"
+	} else {
+		s += "]"
+	}
+	s += " "
+	for i := k; i < len(nm.players); i++ {
+		s += nm.players[i].p.String() + " "
+	}
+	return
+}
+
+func (nm *Manager) assureDoor(dc model.DoorCommand) {
+	if nm.doors[dc.D] == dc {
+		if nm.chatty {
+			log.Printf("Door already %v.\n", dc)
+		}
+		return
+	}
+	nm.doors[dc.D] = dc
+	if nm.chatty {
+		log.Printf("Queueing door command: %v\n", dc)
+	}
+	nm.doorQueue = append(nm.doorQueue, dc)
+}
+
+func (nm *Manager) sayHelloToEveryone() {
+	if nm.chatty {
+		log.Printf("Me (%v) saying Hello to %d other players.\n",
+			nm.Me(), len(nm.players))
+	}
+	wp := ifc.Player{int32(nm.Me().Id())}
+	rs := nm.eachPlayer("Recognize", func(rp *remote) error {
+		if nm.chatty {
+			log.Printf("Asking %v to recognize me=%v", rp.p, nm.Me())
+		}
+		return rp.c.Recognize(wp)
+	})
+	if err := rs.Err(); err != nil {
+		log.Printf("Unable to greet everyone: %v", err)
+	}
+	if nm.chatty {
+		log.Printf("Me (%v) DONE saying Hello.\n", nm.Me())
+	}
+}
+
+func (nm *Manager) sayGoodbyeToEveryone() {
+	if nm.chatty {
+		log.Println("Saying goodbye to other players.")
+	}
+	wp := ifc.Player{int32(nm.Me().Id())}
+	for _, rp := range nm.players {
+		if nm.chatty {
+			log.Printf("Asking %v to forget me=%v", rp.p, nm.Me())
+		}
+		if err := rp.c.Forget(wp); err != nil {
+			log.Println("Forget failed, but continuing; err=", err)
+		}
+	}
+}
+
+func (nm *Manager) JoinGame(chBc <-chan model.BallCommand) {
+	if nm.chatty {
+		log.Println("Joining game.")
+	}
+	nm.chBallCommand = chBc
+	for _, id := range nm.initialPlayerNumbers {
+		nm.recognizeOther(model.NewPlayer(id))
+	}
+	if nm.chatty {
+		log.Printf("I see %d players.\n", len(nm.players))
+	}
+	nm.learnRoom()
+	if nm.isGameMaster {
+		if chBc != nil {
+			log.Panic("game master should not have chBc")
+		}
+		return
+	}
+	nm.sayHelloToEveryone()
+	nm.checkDoors()
+	nm.isRunning = true
+	go nm.run()
+}
+
+// Ask the others how the room is arranged.  Players keep the room in
+// their relay too, so they can tell those who join later.
+func (nm *Manager) learnRoom() {
+	candidates := append([]*remote{}, nm.players...)
+	for _, rp := range candidates {
+		var wr ifc.Room
+		err := nm.callPlayer(rp, "GetRoom", func(rp *remote) (err error) {
+			wr, err = rp.c.GetRoom()
+			return
+		})
+		if err != nil {
+			continue
+		}
+		if nm.isGameMaster {
+			nm.room = relay.DeserializeRoom(wr)
+		} else {
+			nm.relay.SetRoom(nil, nil, wr)
+		}
+		return
+	}
+}
+
+func (nm *Manager) setRoom(room model.Room) {
+	if nm.chatty {
+		log.Printf("Room is now %v.", room)
+	}
+	nm.room = room
+	nm.checkDoors()
+}
+
+func (nm *Manager) run() {
+	if nm.chatty {
+		log.Println("Starting Manager run loop.")
+	}
+	ticker := time.NewTicker(nm.pingInterval)
+	defer ticker.Stop()
+	ticks := 0
+	for {
+		// Door commands wait in a queue rather than block the loop, as
+		// the engine may itself be blocked handing us a ball to throw.
+		var chDoor chan model.DoorCommand
+		var dc model.DoorCommand
+		if len(nm.doorQueue) > 0 {
+			chDoor, dc = nm.chDoorCommand, nm.doorQueue[0]
+		}
+		select {
+		case chDoor <- dc:
+			if nm.chatty {
+				log.Printf("Door command %v consumed.\n", dc)
+			}
+			nm.doorQueue = nm.doorQueue[1:]
+		case ch := <-nm.chStop:
+			nm.stop()
+			ch <- true
+			return
+		case ch := <-nm.chNoNewBallsOrPeople:
+			nm.noNewBallsOrPeople()
+			ch <- true
+		case bc := <-nm.chBallCommand:
+			nm.throwBall(bc)
+		case p := <-nm.relay.ChRecognize():
+			nm.recognizeOther(p)
+		case p := <-nm.relay.ChForget():
+			nm.forgetOther(p)
+		case room := <-nm.relay.ChRoom():
+			nm.setRoom(room)
+		case <-ticker.C:
+			nm.pingNeighbors()
+			ticks++
+			if ticks%relistPings == 0 {
+				nm.lookForComebacks()
+			}
+		case pg := <-nm.chPong:
+			nm.handlePong(pg)
+		case co := <-nm.chOffset:
+			if rp := nm.findPlayer(co.p.Id()); rp != nil {
+				rp.offset = co.offset
+			}
+		case rs := <-nm.chCalled:
+			for _, e := range rs.Failures() {
+				nm.evict(e)
+			}
+			if err := rs.Err(); err != nil {
+				log.Printf("Unable to reach everyone: %v", err)
+			}
+		case ids := <-nm.chComeback:
+			nm.relisting = false
+			for _, id := range ids {
+				if nm.chatty {
+					log.Printf("Player %d is back.", id)
+				}
+				nm.recognizeOther(model.NewPlayer(id))
+			}
+		}
+	}
+}
+
+func (nm *Manager) Quit(id int) error {
+	rp := nm.findPlayer(id)
+	if rp == nil {
+		return fmt.Errorf("no player %d", id)
+	}
+	if nm.chatty {
+		log.Printf("Killing  %v", rp.p)
+	}
+	return nm.callPlayer(rp, "Quit", func(rp *remote) error {
+		return rp.c.Quit()
+	})
+}
+
+// List asks the players t picks what they're up to.  Players that
+// don't answer are left out, and returned as PeerErrors.
+func (nm *Manager) List(t model.Target) ([]*model.State, error) {
+	st := &stateTaker{sync.Mutex{}, make(map[int]*model.State)}
+	rs := nm.eachTarget(t, "GetState", st.ask)
+	return st.inOrder(rs), rs.Err()
+}
+
+// Poll has the game master catch up with the room, as Refresh does,
+// and ask every player what it's up to.  Players that don't say are
+// left out, but not dropped: one that's busy, or whose engine isn't
+// running yet, is still playing.  Who has gone is for the transport to
+// say.
+func (nm *Manager) Poll() ([]*model.State, error) {
+	if err := nm.Refresh(); err != nil {
+		return nil, err
+	}
+	st := &stateTaker{sync.Mutex{}, make(map[int]*model.State)}
+	return st.inOrder(callEach(nm.players, "GetState", st.ask)), nil
+}
+
+// Collects what players say they're up to, from calls made at once.
+type stateTaker struct {
+	mu   sync.Mutex
+	byId map[int]*model.State
+}
+
+func (st *stateTaker) ask(rp *remote) error {
+	ws, err := rp.c.GetState()
+	if err != nil {
+		return err
+	}
+	s := relay.DeserializeState(ws)
+	s.Player = rp.p
+	st.mu.Lock()
+	st.byId[rp.p.Id()] = &s
+	st.mu.Unlock()
+	return nil
+}
+
+// The states of the players that said, in the order of the calls.
+func (st *stateTaker) inOrder(rs model.Results) []*model.State {
+	states := []*model.State{}
+	for _, r := range rs {
+		if s, ok := st.byId[r.Player.Id()]; ok {
+			states = append(states, s)
+		}
+	}
+	return states
+}
+
+// FireBall drops count balls in on the players t picks, in rounds a
+// moment apart, so balls fired together don't land on top of each
+// other.
+func (nm *Manager) FireBall(
+	count int, t model.Target) (model.Results, error) {
+	var rs model.Results
+	for k := 0; k < count; k++ {
+		if k > 0 {
+			<-time.After(fireInterval)
+		}
+		rs = append(rs, nm.eachTarget(t, "Accept", func(rp *remote) error {
+			wb := relay.FiredBall(rp.p)
+			if nm.chatty {
+				log.Printf("Fire ball to %v\n", rp.p)
+			}
+			return rp.c.Accept(wb)
+		})...)
+	}
+	return rs, rs.Err()
+}
+
+// DoMasterCommand has the players t picks do command c.  Picking is
+// done here, from the master's view of the room, so the command goes
+// only to those players, and every result is for one that heard it.
+func (nm *Manager) DoMasterCommand(
+	c string, t model.Target) (model.Results, error) {
+	mc := ifc.MasterCommand{Name: c}
+	rs := nm.eachTarget(t, "DoMasterCommand", func(rp *remote) error {
+		if nm.chatty {
+			log.Printf("Commanding %v to %v", rp.p, mc)
+		}
+		return rp.c.DoMasterCommand(mc)
+	})
+	return rs, rs.Err()
+}
+
+func (nm *Manager) SetPauseDuration(
+	pd float32, t model.Target) (model.Results, error) {
+	rs := nm.eachTarget(t, "SetPauseDuration", func(rp *remote) error {
+		if nm.chatty {
+			log.Printf("Setting pause duration to %.2f", pd)
+		}
+		return rp.c.SetPauseDuration(pd)
+	})
+	return rs, rs.Err()
+}
+
+func (nm *Manager) SetGravity(
+	g float32, t model.Target) (model.Results, error) {
+	rs := nm.eachTarget(t, "SetGravity", func(rp *remote) error {
+		if nm.chatty {
+			log.Printf("Setting gravity to %.2f", g)
+		}
+		return rp.c.SetGravity(g)
+	})
+	return rs, rs.Err()
+}
+
+// Refresh has the game master catch up with the players that joined
+// or left since it joined the game, and with the room.  Players need
+// not, as they hear of each other directly.
+func (nm *Manager) Refresh() error {
+	ids, err := nm.transport.List()
+	if err != nil {
+		return err
+	}
+	present := make(map[int]bool)
+	for _, id := range ids {
+		present[id] = true
+		nm.recognizeOther(model.NewPlayer(id))
+	}
+	for _, id := range nm.playerIds() {
+		if !present[id] {
+			if nm.chatty {
+				log.Printf("Player %d has left.", id)
+			}
+			i := nm.findPlayerIndex(model.NewPlayer(id))
+			nm.players = append(nm.players[:i], nm.players[i+1:]...)
+		}
+	}
+	nm.learnRoom()
+	return nil
+}
+
+func (nm *Manager) Room() model.Room {
+	return nm.room
+}
+
+func (nm *Manager) SetRoom(room model.Room) error {
+	wr := relay.SerializeRoom(room)
+	nm.room = room
+	return nm.eachPlayer("SetRoom", func(rp *remote) error {
+		if nm.chatty {
+			log.Printf("Setting room of %v to %v", rp.p, room)
+		}
+		return rp.c.SetRoom(wr)
+	}).Err()
+}
+
+// Advertise answers other players' GetSize calls with d from now on.
+func (nm *Manager) Advertise(d model.Dimensions) {
+	if nm.chatty {
+		log.Printf("Advertising screen size %.0fx%.0fmm", d.W, d.H)
+	}
+	nm.relay.SetSize(d)
+}
+
+func (nm *Manager) ScreenSize(id int) (d model.Dimensions, err error) {
+	rp := nm.findPlayer(id)
+	if rp == nil {
+		return d, fmt.Errorf("no player %d", id)
+	}
+	err = nm.callPlayer(rp, "GetSize", func(rp *remote) error {
+		ws, err := rp.c.GetSize()
+		d = model.Dimensions{ws.W, ws.H}
+		return err
+	})
+	return
+}
+
+// Make the call f to every player at once, evicting those it fails
+// on.  Transports bound each call with a deadline of their own, so a
+// slow player holds up the others no longer than that.
+func (nm *Manager) eachPlayer(
+	op string, f func(rp *remote) error) model.Results {
+	return nm.callAll(nm.players, op, f)
+}
+
+// Make the call f to the players t picks, as they stand in the room,
+// as eachPlayer does.  Players picked by id that aren't in the room
+// fail without being called.
+func (nm *Manager) eachTarget(
+	t model.Target, op string, f func(rp *remote) error) model.Results {
+	picked := []*remote{}
+	ids := nm.playerIds()
+	for i, rp := range nm.players {
+		others := append(append([]int{}, ids[:i]...), ids[i+1:]...)
+		if topology.Picks(nm.room, t, rp.p.Id(), others) {
+			picked = append(picked, rp)
+		}
+	}
+	var missing model.Results
+	for _, id := range t.Ids {
+		if nm.findPlayer(id) == nil {
+			missing = append(missing, &model.PeerResult{
+				model.NewPlayer(id), op, 0, fmt.Errorf("no player %d", id)})
+		}
+	}
+	return append(nm.callAll(picked, op, f), missing...)
+}
+
+// Make the call f to every player at once, as eachPlayer does, but off
+// the run loop, so a slow player holds up nothing.  The run loop evicts
+// those it failed on when it hears back.
+func (nm *Manager) eachPlayerLater(op string, f func(rp *remote) error) {
+	rps := append([]*remote{}, nm.players...)
+	go func() {
+		rs := callEach(rps, op, f)
+		select {
+		case nm.chCalled <- rs:
+		case <-nm.chDone:
+		}
+	}()
+}
+
+// Make the call f to the players rps at once, evicting those it fails
+// on.
+func (nm *Manager) callAll(
+	rps []*remote, op string, f func(rp *remote) error) model.Results {
+	rs := callEach(rps, op, f)
+	for _, e := range rs.Failures() {
+		nm.evict(e)
+	}
+	return rs
+}
+
+// Make the call f to the players rps at once, touching nothing but
+// their ids and peers, so it's safe off the run loop.
+func callEach(
+	rps []*remote, op string, f func(rp *remote) error) model.Results {
+	rs := make(model.Results, len(rps))
+	var wg sync.WaitGroup
+	for i, rp := range rps {
+		wg.Add(1)
+		go func(i int, rp *remote) {
+			defer wg.Done()
+			t0 := time.Now()
+			err := f(rp)
+			rs[i] = &model.PeerResult{rp.p, op, time.Since(t0), err}
+		}(i, rp)
+	}
+	wg.Wait()
+	return rs
+}
+
+// Make the call f to one player, evicting it if the call fails.
+func (nm *Manager) callPlayer(
+	rp *remote, op string, f func(rp *remote) error) error {
+	if err := f(rp); err != nil {
+		e := &model.PeerError{rp.p, op, err}
+		nm.evict(e)
+		return e
+	}
+	return nil
+}
+
+// Drop a player that failed a call.  It's taken back if it says hello
+// again, or turns up alive later; see lookForComebacks.
+func (nm *Manager) evict(e *model.PeerError) {
+	log.Printf("Evicting player %v: %v", e.Player, e)
+	i := nm.findPlayerIndex(e.Player)
+	if i < 0 {
+		return
+	}
+	nm.players = append(nm.players[:i], nm.players[i+1:]...)
+	if nm.isRunning {
+		nm.checkDoors()
+	}
+	select {
+	case nm.chPeerLost <- e.Player:
+	default:
+		log.Printf("Nobody listening for lost players, dropping %v.", e.Player)
+	}
+}
+
+// Ping the players next door.  Nobody else is pinged; each player
+// watches its own neighbors, so every live player is watched by someone.
+func (nm *Manager) pingNeighbors() {
+	for _, d := range model.Directions {
+		id, ok := topology.Neighbor(nm.room, nm.Me().Id(), nm.playerIds(), d)
+		if !ok {
+			continue
+		}
+		rp := nm.findPlayer(id)
+		if rp.pinging {
+			continue
+		}
+		rp.pinging = true
+		go func(rp *remote) {
+			err := rp.c.Ping(pingTimeout)
+			select {
+			case nm.chPong <- pong{rp.p, err}:
+			case <-nm.chDone:
+			}
+		}(rp)
+	}
+}
+
+// A neighbor that misses too many pings in a row is evicted, and
+// everyone else is told to forget it, since it can't say goodbye.
+func (nm *Manager) handlePong(pg pong) {
+	rp := nm.findPlayer(pg.p.Id())
+	if rp == nil {
+		// Left while the ping was out.
+		return
+	}
+	rp.pinging = false
+	if pg.err == nil {
+		rp.misses = 0
+		return
+	}
+	rp.misses++
+	if nm.chatty {
+		log.Printf("Player %v missed %d pings; err=%v", rp.p, rp.misses, pg.err)
+	}
+	if rp.misses < maxMissedPings {
+		return
+	}
+	nm.evict(&model.PeerError{rp.p, "Ping", pg.err})
+	wp := ifc.Player{int32(rp.p.Id())}
+	nm.eachPlayerLater("Forget", func(other *remote) error {
+		return other.c.Forget(wp)
+	})
+}
+
+// Look, off the run loop, for players that are still about but that
+// were dropped, say after a call to them failed just once.  They may
+// never say hello again, having never dropped us, so those that answer
+// a ping are taken back.  Players that left aren't listed, and those
+// that died don't answer.
+func (nm *Manager) lookForComebacks() {
+	if nm.relisting || nm.isLeaving {
+		return
+	}
+	nm.relisting = true
+	known := map[int]bool{nm.Me().Id(): true}
+	for _, id := range nm.playerIds() {
+		known[id] = true
+	}
+	go func() {
+		back := []int{}
+		ids, err := nm.transport.List()
+		if err != nil {
+			log.Printf("Unable to look for players; err=%v", err)
+		}
+		for _, id := range ids {
+			if !known[id] && nm.transport.Dial(id).Ping(pingTimeout) == nil {
+				back = append(back, id)
+			}
+		}
+		select {
+		case nm.chComeback <- back:
+		case <-nm.chDone:
+		}
+	}()
+}
+
+// Throw ball to the neighbor in the ball's direction.
+func (nm *Manager) throwBall(bc model.BallCommand) {
+	if nm.chatty {
+		log.Printf("Manager got ball throw command: %v\n", bc)
+	}
+	id, ok := topology.Neighbor(nm.room, nm.Me().Id(), nm.playerIds(), bc.D)
+	if !ok {
+		// The neighbor left while the ball was on its way out.
+		if nm.chatty {
+			log.Printf("Nobody on %v!  Send back to table.", bc.D)
+		}
+		nm.depositBall(bc)
+		return
+	}
+	nm.sendBall(bc, nm.findPlayer(id))
+}
+
+// Hand a ball nobody can catch to the table, the player with the
+// lowest id, which every player agrees on without asking.  If the
+// table is gone the next lowest takes over, and failing all else the
+// ball drops back in here.  A player that's leaving is no table, so
+// hands the ball to the lowest of those staying.
+func (nm *Manager) depositBall(bc model.BallCommand) {
+	wb := relay.SerializeBall(bc.B)
+	// Copied, since a failed call evicts.
+	candidates := append([]*remote{}, nm.players...)
+	for _, rp := range candidates {
+		if rp.p.Id() > nm.Me().Id() && !nm.isLeaving {
+			break
+		}
+		err := nm.callPlayer(rp, "Deposit", func(rp *remote) error {
+			return rp.c.Deposit(wb)
+		})
+		if err == nil {
+			return
+		}
+	}
+	nm.relay.Deposit(nil, nil, wb)
+}
+
+func (nm *Manager) sendBall(bc model.BallCommand, rp *remote) {
+	wb := relay.HandoffBall(nm.room, nm.Me().Id(), rp.p.Id(), bc)
+	// Stamp the ball by the receiver's clock, so it can tell how long
+	// the ball was in flight.
+	wb.SentAt = time.Now().Add(rp.offset).UnixNano()
+	if nm.chatty {
+		log.Printf("Throwing ball %v to %v\n", bc.D, rp.p)
+	}
+	err := nm.callPlayer(rp, "Accept", func(rp *remote) error {
+		return rp.c.Accept(wb)
+	})
+	if err != nil {
+		// The door is closed now, so let the ball come home.
+		nm.relay.Bounce(bc)
+		return
+	}
+	if nm.chatty {
+		log.Printf("Ball throw %v done.", bc.D)
+	}
+}
+
+func (nm *Manager) NoNewBallsOrPeople() {
+	ch := make(chan bool)
+	nm.chNoNewBallsOrPeople <- ch
+	<-ch
+}
+
+func (nm *Manager) noNewBallsOrPeople() {
+	if nm.chatty {
+		log.Println("********************* No New Balls or people.")
+	}
+	nm.isLeaving = true
+	nm.relay.StopAcceptingData()
+	// Give up the id first, so nobody looking for comebacks takes us
+	// back after the goodbye.
+	if err := nm.transport.Leave(); err != nil {
+		log.Printf("Unable to give up my id; err=%v", err)
+	}
+	nm.sayGoodbyeToEveryone()
+}
+
+func (nm *Manager) Stop() {
+	ch := make(chan bool)
+	nm.chStop <- ch
+	<-ch
+}
+
+func (nm *Manager) stop() {
+	close(nm.chDone)
+	if nm.chatty {
+		log.Println("Closing transport.")
+	}
+	nm.transport.Close()
+	if nm.chatty {
+		log.Println("Closing door command channel.")
+	}
+	close(nm.chDoorCommand)
+	if nm.chatty {
+		log.Println("Manager done.")
+	}
+}
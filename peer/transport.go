@@ -0,0 +1,51 @@
+package peer
+
+import (
+	"github.com/monopole/volley/ifc"
+	"github.com/monopole/volley/relay"
+	"time"
+)
+
+// Transport is how players find and call each other: v23 RPCs through
+// a mounttable, say, or JSON over plain TCP.  The Manager does the
+// rest.
+//
+// Open is called once, before anything else, and Close once, last.  A
+// player calls Join and, when it leaves, Leave; the game master only
+// ever calls List.
+type Transport interface {
+	Open() error
+	// Ids of the players present, in any order.
+	List() ([]int, error)
+	// Take a player id, serve calls to it with the relay, and return
+	// the id with the ids of the players present after taking it.  Of
+	// several players joining at once, no two may get the same id, and
+	// the last to join must see all the others.
+	Join(r *relay.Relay) (int, []int, error)
+	// Give up the id taken by Join.
+	Leave() error
+	// A way to call the player with the given id.  Dialing can't
+	// fail; calls to a player that isn't there can.
+	Dial(id int) Peer
+	Close()
+}
+
+// Peer is another player, as reached through a transport.  The calls
+// are those of ifc.GameService, and land on the other player's relay.
+type Peer interface {
+	Recognize(p ifc.Player) error
+	Forget(p ifc.Player) error
+	Accept(b ifc.Ball) error
+	Deposit(b ifc.Ball) error
+	Quit() error
+	Now() (int64, error)
+	// Fails if the player doesn't answer within wait.
+	Ping(wait time.Duration) error
+	DoMasterCommand(c ifc.MasterCommand) error
+	SetPauseDuration(p float32) error
+	SetGravity(g float32) error
+	SetRoom(r ifc.Room) error
+	GetRoom() (ifc.Room, error)
+	GetSize() (ifc.Size, error)
+	GetState() (ifc.State, error)
+}
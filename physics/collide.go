@@ -0,0 +1,146 @@
+package physics
+
+import (
+	"github.com/monopole/volley/model"
+	"math"
+)
+
+// Balls are bucketed into square cells at least as wide as the widest
+// ball, so a ball can only touch balls in its own or adjacent cells.
+// This keeps collision checks close to linear in the number of balls.
+type cell struct {
+	x int
+	y int
+}
+
+// Per ball state for collision handling, in pixels rather than the
+// dimensionless units balls carry.
+type body struct {
+	b    *model.Ball
+	x    float32
+	y    float32
+	vx   float32
+	vy   float32
+	r    float32
+	invM float32
+}
+
+func (w *World) shortSide() float32 {
+	if w.width < w.height {
+		return w.width
+	}
+	return w.height
+}
+
+// collide resolves elastic collisions between all pairs of balls that
+// overlap and are approaching each other.
+func (w *World) collide() {
+	if len(w.balls) < 2 || w.pauseDuration <= 0 {
+		return
+	}
+	velX0 := w.width / w.pauseDuration
+	velY0 := w.height / w.pauseDuration
+	if velX0 <= 0 || velY0 <= 0 {
+		return
+	}
+	side := w.shortSide()
+	bodies := make([]body, len(w.balls))
+	maxR := float32(0)
+	for i, b := range w.balls {
+		invM := float32(1)
+		if b.Mass() > 0 {
+			invM = 1 / b.Mass()
+		}
+		bodies[i] = body{
+			b,
+			b.GetPos().X, b.GetPos().Y,
+			b.GetVel().X * velX0, b.GetVel().Y * velY0,
+			b.Radius() * side,
+			invM,
+		}
+		if bodies[i].r > maxR {
+			maxR = bodies[i].r
+		}
+	}
+	if maxR <= 0 {
+		return
+	}
+	size := 2 * maxR
+	grid := make(map[cell][]int)
+	cells := make([]cell, len(bodies))
+	for i := range bodies {
+		c := cell{
+			int(math.Floor(float64(bodies[i].x / size))),
+			int(math.Floor(float64(bodies[i].y / size)))}
+		cells[i] = c
+		grid[c] = append(grid[c], i)
+	}
+	touched := false
+	for i := range bodies {
+		c := cells[i]
+		for gx := c.x - 1; gx <= c.x+1; gx++ {
+			for gy := c.y - 1; gy <= c.y+1; gy++ {
+				for _, j := range grid[cell{gx, gy}] {
+					if j > i && bounce(&bodies[i], &bodies[j]) {
+						touched = true
+					}
+				}
+			}
+		}
+	}
+	if !touched {
+		return
+	}
+	for _, bd := range bodies {
+		bd.b.SetPos(clamp(bd.x, 0, w.width), clamp(bd.y, 0, w.height))
+		bd.b.SetVel(bd.vx/velX0, bd.vy/velY0)
+	}
+}
+
+// bounce exchanges momentum between two overlapping bodies heading
+// toward each other, and pushes them apart so they don't stick.
+// Returns true if the bodies touched.
+func bounce(p *body, q *body) bool {
+	dx := q.x - p.x
+	dy := q.y - p.y
+	reach := p.r + q.r
+	dsq := dx*dx + dy*dy
+	if dsq >= reach*reach {
+		return false
+	}
+	d := float32(math.Sqrt(float64(dsq)))
+	nx, ny := float32(1), float32(0)
+	if d > 0 {
+		nx, ny = dx/d, dy/d
+	}
+	invSum := p.invM + q.invM
+
+	// Separate along the normal, in inverse proportion to mass.
+	overlap := reach - d
+	p.x -= nx * overlap * p.invM / invSum
+	p.y -= ny * overlap * p.invM / invSum
+	q.x += nx * overlap * q.invM / invSum
+	q.y += ny * overlap * q.invM / invSum
+
+	closing := (q.vx-p.vx)*nx + (q.vy-p.vy)*ny
+	if closing >= 0 {
+		// Already moving apart.
+		return true
+	}
+	j := -2 * closing / invSum
+	p.vx -= j * p.invM * nx
+	p.vy -= j * p.invM * ny
+	q.vx += j * q.invM * nx
+	q.vy += j * q.invM * ny
+	return true
+}
+
+func clamp(v float32, lo float32, hi float32) float32 {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
@@ -0,0 +1,19 @@
+package physics
+
+import (
+	"github.com/monopole/volley/model"
+)
+
+// Refract converts a dimensionless velocity from one arena to another
+// of a different shape, given each arena's width over height.
+//
+// Measured in arena heights, a ball keeps both its speed and its
+// direction; only the horizontal component changes, to account for
+// the wider or narrower arena.  An aspect ratio that isn't positive is
+// treated as unknown, and the velocity is returned unchanged.
+func Refract(v model.Vec, fromAspect float32, toAspect float32) model.Vec {
+	if fromAspect <= 0 || toAspect <= 0 {
+		return v
+	}
+	return model.Vec{v.X * fromAspect / toAspect, v.Y}
+}
@@ -0,0 +1,237 @@
+// Package physics moves balls around a rectangular arena.
+//
+// It knows nothing about GL contexts, windows or the network, so the
+// engine, the master tool and tests can all drive the same simulation.
+// Balls leaving through an open door are reported as exits; what to do
+// with them is the caller's business.
+package physics
+
+import (
+	"github.com/monopole/volley/model"
+)
+
+// Exit reports a ball that left the arena through an open door.  The
+// ball is no longer in the world, and its position is where it crossed
+// the edge.
+type Exit struct {
+	B *model.Ball
+	D model.Direction
+}
+
+// World is a rectangular arena holding balls.
+//
+// Positions are in the arena's own units (the engine uses pixels),
+// with (0,0) in the upper left corner and y growing downward.
+//
+// Velocities are dimensionless: a velocity of 1 along an axis crosses
+// the arena along that axis in one pauseDuration.  Time, as passed to
+// Step, is in the same unit as pauseDuration.  Gravity is the change
+// in y velocity per unit time.
+type World struct {
+	width         float32
+	height        float32
+	gravity       float32
+	pauseDuration float32
+	doors         map[model.Direction]model.DoorCommand
+	balls         []*model.Ball
+}
+
+func NewWorld(width float32, height float32, pauseDuration float32) *World {
+	return &World{
+		width,
+		height,
+		0, // gravity
+		pauseDuration,
+		model.ClosedDoors(),
+		[]*model.Ball{},
+	}
+}
+
+func (w *World) Width() float32 {
+	return w.width
+}
+
+func (w *World) Height() float32 {
+	return w.height
+}
+
+// SetSize changes the size of the arena, moving every ball so it
+// keeps its place relative to the arena's edges.  Velocities are
+// already relative to the arena's size, so a ball still takes the
+// same time to cross it.  Balls that somehow lie outside the new
+// bounds are pulled back in.
+func (w *World) SetSize(width float32, height float32) {
+	sx, sy := float32(1), float32(1)
+	if w.width > 0 {
+		sx = width / w.width
+	}
+	if w.height > 0 {
+		sy = height / w.height
+	}
+	w.width = width
+	w.height = height
+	for _, b := range w.balls {
+		b.SetPos(
+			clamp(b.GetPos().X*sx, 0, width),
+			clamp(b.GetPos().Y*sy, 0, height))
+	}
+}
+
+func (w *World) Gravity() float32 {
+	return w.gravity
+}
+
+func (w *World) SetGravity(g float32) {
+	w.gravity = g
+}
+
+func (w *World) PauseDuration() float32 {
+	return w.pauseDuration
+}
+
+func (w *World) SetPauseDuration(pd float32) {
+	w.pauseDuration = pd
+}
+
+func (w *World) Door(d model.Direction) model.DoorState {
+	return w.doors[d].S
+}
+
+// Doors returns the door in every direction, in the order of
+// model.Directions.
+func (w *World) Doors() []model.DoorCommand {
+	doors := make([]model.DoorCommand, len(model.Directions))
+	for i, d := range model.Directions {
+		doors[i] = w.doors[d]
+	}
+	return doors
+}
+
+// SetDoor opens or closes a door, or changes how much of its edge it
+// spans.
+func (w *World) SetDoor(dc model.DoorCommand) {
+	w.doors[dc.D] = dc
+}
+
+// Whether a ball at x, y on the edge in direction d passes through.
+func (w *World) openAt(d model.Direction, x, y float32) bool {
+	if d.Horizontal() {
+		return w.height > 0 && w.doors[d].OpenAt(y/w.height)
+	}
+	return w.width > 0 && w.doors[d].OpenAt(x/w.width)
+}
+
+// Balls returns the balls currently in the world.  The slice is owned
+// by the world; callers may change the balls, but not the slice.
+func (w *World) Balls() []*model.Ball {
+	return w.balls
+}
+
+func (w *World) Add(b *model.Ball) {
+	w.balls = append(w.balls, b)
+}
+
+// Clear removes all balls from the world, returning them.
+func (w *World) Clear() []*model.Ball {
+	balls := w.balls
+	w.balls = []*model.Ball{}
+	return balls
+}
+
+// Step advances every ball by dt, bouncing balls off walls, closed
+// doors and each other.  Balls that cross an open door are removed
+// from the world and returned, in the order they were held.
+func (w *World) Step(dt float32) []Exit {
+	exits := []Exit{}
+	if w.pauseDuration <= 0 {
+		return exits
+	}
+	kept := w.balls[:0]
+	for _, b := range w.balls {
+		if d, exited := w.move(b, dt, true); exited {
+			exits = append(exits, Exit{b, d})
+		} else {
+			kept = append(kept, b)
+		}
+	}
+	// Don't let the tail of the old slice pin exited balls.
+	for i := len(kept); i < len(w.balls); i++ {
+		w.balls[i] = nil
+	}
+	w.balls = kept
+	w.collide()
+	return exits
+}
+
+// Coast moves a single ball, which need not be in the world, along
+// the path it would have taken over dt, in increments of at most step.
+// The ball bounces off every edge, open doors included, and ignores
+// other balls.  Used to catch up on time a ball spent in flight
+// between screens.
+func (w *World) Coast(b *model.Ball, dt float32, step float32) {
+	if w.pauseDuration <= 0 || step <= 0 {
+		return
+	}
+	for dt > 0 {
+		h := step
+		if dt < step {
+			h = dt
+		}
+		w.move(b, h, false)
+		dt -= h
+	}
+}
+
+// move advances one ball by dt.  If useDoors is true and the ball
+// crosses an open door, it returns the door's direction and true.
+func (w *World) move(
+	b *model.Ball, dt float32, useDoors bool) (model.Direction, bool) {
+	velX0 := w.width / w.pauseDuration
+	velY0 := w.height / w.pauseDuration
+	dx := b.GetVel().X
+	dy := b.GetVel().Y + w.gravity*dt
+
+	nx := b.GetPos().X + dx*velX0*dt
+	ny := b.GetPos().Y + dy*velY0*dt
+	exit := model.Left
+	exited := false
+	if nx <= 0 {
+		// Ball hit left side.
+		nx = 0
+		if useDoors && w.openAt(model.Left, nx, ny) {
+			exit, exited = model.Left, true
+		} else {
+			dx = -dx
+		}
+	} else if nx >= w.width {
+		// Ball hit right side.
+		nx = w.width
+		if useDoors && w.openAt(model.Right, nx, ny) {
+			exit, exited = model.Right, true
+		} else {
+			dx = -dx
+		}
+	}
+	// A ball leaving through a side door doesn't also leave through
+	// the top or bottom.
+	if ny <= 0 {
+		// Ball hit top.
+		ny = 0
+		if useDoors && !exited && w.openAt(model.Up, nx, ny) {
+			exit, exited = model.Up, true
+		} else {
+			dy = -dy
+		}
+	} else if ny >= w.height {
+		// Ball hit bottom.
+		ny = w.height
+		if useDoors && !exited && w.openAt(model.Down, nx, ny) {
+			exit, exited = model.Down, true
+		} else {
+			dy = -dy
+		}
+	}
+	b.SetPos(nx, ny)
+	b.SetVel(dx, dy)
+	return exit, exited
+}
@@ -0,0 +1,264 @@
+package physics
+
+import (
+	"github.com/monopole/volley/model"
+	"math"
+	"testing"
+)
+
+func newBall(x, y, dx, dy float32) *model.Ball {
+	return model.NewBall(nil, model.Vec{x, y}, model.Vec{dx, dy})
+}
+
+func TestStepMovesByPauseDuration(t *testing.T) {
+	w := NewWorld(100, 50, 10)
+	b := newBall(50, 25, 0.5, -0.5)
+	w.Add(b)
+	if exits := w.Step(2); len(exits) != 0 {
+		t.Fatalf("unexpected exits %v", exits)
+	}
+	// Unit velocity crosses 100 wide in 10 time units, so 0.5 for 2
+	// units moves 10 in x; likewise 5 in y.
+	if p := b.GetPos(); p.X != 60 || p.Y != 20 {
+		t.Errorf("got pos %v, want {60, 20}", p.String())
+	}
+}
+
+func TestClosedDoorBounces(t *testing.T) {
+	w := NewWorld(100, 100, 10)
+	b := newBall(5, 50, -1, 0)
+	w.Add(b)
+	if exits := w.Step(1); len(exits) != 0 {
+		t.Fatalf("unexpected exits %v", exits)
+	}
+	if b.GetPos().X != 0 {
+		t.Errorf("got x %.2f, want 0", b.GetPos().X)
+	}
+	if b.GetVel().X != 1 {
+		t.Errorf("got dx %.2f, want 1", b.GetVel().X)
+	}
+	if len(w.Balls()) != 1 {
+		t.Errorf("ball left the world")
+	}
+}
+
+func TestOpenDoorExits(t *testing.T) {
+	w := NewWorld(100, 100, 10)
+	w.SetDoor(model.WholeDoor(model.Open, model.Right))
+	stay := newBall(50, 50, 0, 0)
+	leave := newBall(95, 50, 1, 0)
+	w.Add(leave)
+	w.Add(stay)
+	exits := w.Step(1)
+	if len(exits) != 1 {
+		t.Fatalf("got %d exits, want 1", len(exits))
+	}
+	if exits[0].B != leave || exits[0].D != model.Right {
+		t.Errorf("got exit %v %v", exits[0].B, exits[0].D)
+	}
+	if exits[0].B.GetPos().X != 100 {
+		t.Errorf("exit at x %.2f, want 100", exits[0].B.GetPos().X)
+	}
+	if len(w.Balls()) != 1 || w.Balls()[0] != stay {
+		t.Errorf("got balls %v, want only %v", w.Balls(), stay)
+	}
+}
+
+func TestBottomDoorExits(t *testing.T) {
+	w := NewWorld(100, 100, 10)
+	w.SetDoor(model.WholeDoor(model.Open, model.Down))
+	w.SetGravity(1)
+	b := newBall(50, 99, 0, 0.5)
+	w.Add(b)
+	exits := w.Step(1)
+	if len(exits) != 1 || exits[0].D != model.Down {
+		t.Fatalf("got exits %v, want one down", exits)
+	}
+	if b.GetPos().Y != 100 {
+		t.Errorf("exit at y %.2f, want 100", b.GetPos().Y)
+	}
+	// The top door is still closed.
+	w.SetGravity(0)
+	c := newBall(50, 1, 0, -1)
+	w.Add(c)
+	if exits := w.Step(1); len(exits) != 0 {
+		t.Errorf("unexpected exits %v", exits)
+	}
+}
+
+func TestPartDoorIsWallElsewhere(t *testing.T) {
+	w := NewWorld(100, 100, 10)
+	// Only the lower half of the right edge faces a neighbor.
+	w.SetDoor(model.DoorCommand{model.Open, model.Right, 0.5, 1})
+	high := newBall(95, 20, 1, 0)
+	low := newBall(95, 80, 1, 0)
+	w.Add(high)
+	w.Add(low)
+	exits := w.Step(1)
+	if len(exits) != 1 || exits[0].B != low {
+		t.Fatalf("got exits %v, want only the low ball", exits)
+	}
+	if high.GetVel().X != -1 {
+		t.Errorf("high ball should bounce, got %v", high)
+	}
+}
+
+func TestGravityAccumulates(t *testing.T) {
+	w := NewWorld(100, 1000, 10)
+	w.SetGravity(0.1)
+	b := newBall(50, 10, 0, 0)
+	w.Add(b)
+	w.Step(1)
+	w.Step(1)
+	if dy := b.GetVel().Y; dy < 0.1999 || dy > 0.2001 {
+		t.Errorf("got dy %.4f, want 0.2", dy)
+	}
+}
+
+func TestStepIsDeterministic(t *testing.T) {
+	run := func() []model.Vec {
+		w := NewWorld(640, 480, 30)
+		w.SetGravity(0.02)
+		w.SetDoor(model.WholeDoor(model.Open, model.Left))
+		for i := 0; i < 10; i++ {
+			w.Add(newBall(float32(60*i), float32(40*i), 0.3, -0.7))
+		}
+		for i := 0; i < 500; i++ {
+			w.Step(1)
+		}
+		result := []model.Vec{}
+		for _, b := range w.Balls() {
+			result = append(result, b.GetPos())
+		}
+		return result
+	}
+	a, b := run(), run()
+	if len(a) != len(b) {
+		t.Fatalf("runs differ in ball count: %d vs %d", len(a), len(b))
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			t.Errorf("ball %d: %v vs %v", i, a[i].String(), b[i].String())
+		}
+	}
+}
+
+func TestHeadOnCollisionSwapsVelocities(t *testing.T) {
+	w := NewWorld(1000, 1000, 10)
+	// Radius is 60 pixels, so these balls are about to touch.
+	p := newBall(400, 500, 0.1, 0)
+	q := newBall(519, 500, -0.1, 0)
+	w.Add(p)
+	w.Add(q)
+	w.Step(0.1)
+	if dx := p.GetVel().X; dx > -0.0999 || dx < -0.1001 {
+		t.Errorf("got p dx %.4f, want -0.1", dx)
+	}
+	if dx := q.GetVel().X; dx < 0.0999 || dx > 0.1001 {
+		t.Errorf("got q dx %.4f, want 0.1", dx)
+	}
+	gap := q.GetPos().X - p.GetPos().X
+	if gap < 119.99 {
+		t.Errorf("balls still overlap, gap %.2f", gap)
+	}
+}
+
+func TestHeavyBallBarelyMoves(t *testing.T) {
+	w := NewWorld(1000, 1000, 10)
+	heavy := newBall(500, 500, 0, 0)
+	heavy.SetMass(1000)
+	light := newBall(390, 500, 0.2, 0)
+	w.Add(heavy)
+	w.Add(light)
+	w.Step(0.1)
+	if dx := heavy.GetVel().X; dx <= 0 || dx > 0.001 {
+		t.Errorf("got heavy dx %.4f, want a small push", dx)
+	}
+	if light.GetVel().X >= 0 {
+		t.Errorf("light ball should rebound, got dx %.4f", light.GetVel().X)
+	}
+}
+
+func TestSpacedBallsStayPut(t *testing.T) {
+	w := NewWorld(1000, 1000, 10)
+	for i := 0; i < 400; i++ {
+		b := newBall(float32(50*(i%20)), float32(50*(i/20)), 0, 0)
+		b.SetRadius(0.01)
+		w.Add(b)
+	}
+	for i := 0; i < 5; i++ {
+		w.Step(0.1)
+	}
+	// 10 pixel radius on a 50 pixel lattice; nothing should touch.
+	for _, b := range w.Balls() {
+		if b.GetVel().X != 0 || b.GetVel().Y != 0 {
+			t.Fatalf("ball %v moved without being hit", b)
+		}
+	}
+}
+
+func TestManyBallsDoNotOverlapAfterSettling(t *testing.T) {
+	w := NewWorld(1000, 1000, 10)
+	for i := 0; i < 100; i++ {
+		b := newBall(float32(300+40*(i%10)), float32(300+40*(i/10)), 0, 0)
+		// 30 pixel radius on a 40 pixel lattice; every ball overlaps
+		// its neighbors.
+		b.SetRadius(0.03)
+		w.Add(b)
+	}
+	for i := 0; i < 200; i++ {
+		w.Step(0.01)
+	}
+	balls := w.Balls()
+	for i, p := range balls {
+		for _, q := range balls[i+1:] {
+			dx := q.GetPos().X - p.GetPos().X
+			dy := q.GetPos().Y - p.GetPos().Y
+			reach := (p.Radius() + q.Radius()) * 1000
+			if d := float32(math.Sqrt(float64(dx*dx + dy*dy))); d < reach-0.01 {
+				t.Fatalf("balls %v and %v overlap: %.2f apart, want %.2f",
+					p, q, d, reach)
+			}
+		}
+	}
+}
+
+func TestRefractKeepsApparentVelocity(t *testing.T) {
+	// Tablet 1600x1000 throws to phone 500x1000.
+	v := Refract(model.Vec{0.5, 0.25}, 1.6, 0.5)
+	// On the tablet the ball moved 800 pixels across and 250 down per
+	// pause duration; on the phone it should do the same.
+	if px, py := v.X*500, v.Y*1000; px != 800 || py != 250 {
+		t.Errorf("got %.1f across and %.1f down, want 800 and 250", px, py)
+	}
+	if u := Refract(model.Vec{0.5, 0.25}, 0, 0.5); u.X != 0.5 || u.Y != 0.25 {
+		t.Errorf("unknown aspect changed velocity to %v", u.String())
+	}
+}
+
+func TestCoastMatchesStepping(t *testing.T) {
+	w := NewWorld(300, 300, 3)
+	w.SetGravity(0.5)
+	w.SetDoor(model.WholeDoor(model.Open, model.Left))
+	stepped := newBall(0, 100, 0.8, -0.4)
+	coasted := newBall(0, 100, 0.8, -0.4)
+	w.Add(stepped)
+	for i := 0; i < 60; i++ {
+		w.Step(1.0 / 60)
+	}
+	w.Coast(coasted, 1, 1.0/60)
+	a, b := stepped.GetPos(), coasted.GetPos()
+	if d := a.X - b.X + a.Y - b.Y; d > 0.01 || d < -0.01 {
+		t.Errorf("stepped to %v but coasted to %v", a.String(), b.String())
+	}
+}
+
+func TestCoastIgnoresOpenDoors(t *testing.T) {
+	w := NewWorld(100, 100, 1)
+	w.SetDoor(model.WholeDoor(model.Open, model.Left))
+	b := newBall(10, 50, -1, 0)
+	w.Coast(b, 0.5, 0.1)
+	if b.GetVel().X != 1 {
+		t.Errorf("ball should have bounced, dx %.2f", b.GetVel().X)
+	}
+}
@@ -5,15 +5,22 @@
 package relay
 
 import (
+	"errors"
 	"github.com/monopole/volley/config"
 	"github.com/monopole/volley/ifc"
 	"github.com/monopole/volley/model"
 	"log"
 	"sync"
+	"time"
 	"v.io/v23/context"
 	"v.io/v23/rpc"
 )
 
+// How long GetState waits for the engine.
+const stateWait = time.Second
+
+var errNoState = errors.New("player isn't playing")
+
 type Relay struct {
 	chRecognize     chan *model.Player
 	chForget        chan *model.Player
@@ -22,8 +29,20 @@ type Relay struct {
 	chMasterCommand chan ifc.MasterCommand
 	chPauseDuration chan float32
 	chGravity       chan float32
-	acceptingData   bool
-	mu              sync.RWMutex
+	chRoom          chan model.Room
+	chState         chan chan model.State
+	// Closed when the relay stops accepting data, to release any
+	// delivery still waiting for a reader.
+	chDone        chan bool
+	stopOnce      sync.Once
+	acceptingData bool
+	mu            sync.RWMutex
+	// The room as last set, and the physical size of this player's
+	// screen, guarded apart from mu so that asking for them never
+	// waits on a delivery.
+	room   model.Room
+	size   model.Dimensions
+	roomMu sync.Mutex
 }
 
 func MakeRelay() *Relay {
@@ -35,6 +54,9 @@ func MakeRelay() *Relay {
 	r.chMasterCommand = make(chan ifc.MasterCommand)
 	r.chPauseDuration = make(chan float32)
 	r.chGravity = make(chan float32)
+	r.chRoom = make(chan model.Room)
+	r.chState = make(chan chan model.State)
+	r.chDone = make(chan bool)
 	r.acceptingData = true
 	if config.Chatty {
 		log.Printf("Made Relay.")
@@ -48,6 +70,11 @@ func (r *Relay) StopAcceptingData() {
 	if config.Chatty {
 		log.Printf("Relay: no more data...")
 	}
+	// A delivery holds the lock until its datum is read, and the
+	// reader may well be the caller, so release deliveries first.
+	r.stopOnce.Do(func() {
+		close(r.chDone)
+	})
 	r.mu.Lock()
 	if config.Chatty {
 		log.Printf("Relay: got the lock.")
@@ -77,6 +104,14 @@ func (r *Relay) ChGravity() <-chan float32 {
 	return r.chGravity
 }
 
+func (r *Relay) ChRoom() <-chan model.Room {
+	return r.chRoom
+}
+
+func (r *Relay) ChState() <-chan chan model.State {
+	return r.chState
+}
+
 func (r *Relay) ChIncomingBall() <-chan *model.Ball {
 	return r.chBall
 }
@@ -101,7 +136,11 @@ func (r *Relay) DoMasterCommand(_ *context.T, _ rpc.ServerCall, mc ifc.MasterCom
 			if config.Chatty {
 				log.Printf("Relay: MasterCommand = %v", mc)
 			}
-			r.chMasterCommand <- mc
+			select {
+			case r.chMasterCommand <- mc:
+			case <-r.chDone:
+				return
+			}
 			if config.Chatty {
 				log.Printf("Relay: Passed in mc.")
 			}
@@ -122,7 +161,11 @@ func (r *Relay) SetPauseDuration(_ *context.T, _ rpc.ServerCall, p float32) erro
 			if config.Chatty {
 				log.Printf("Relay: Pause duration = %.2f", p)
 			}
-			r.chPauseDuration <- p
+			select {
+			case r.chPauseDuration <- p:
+			case <-r.chDone:
+				return
+			}
 			if config.Chatty {
 				log.Printf("Relay: Passed in pause.")
 			}
@@ -143,7 +186,11 @@ func (r *Relay) SetGravity(_ *context.T, _ rpc.ServerCall, g float32) error {
 			if config.Chatty {
 				log.Printf("Relay: gravity = %.2f", g)
 			}
-			r.chGravity <- g
+			select {
+			case r.chGravity <- g:
+			case <-r.chDone:
+				return
+			}
 			if config.Chatty {
 				log.Printf("Relay: Passed in gravity.")
 			}
@@ -156,6 +203,80 @@ func (r *Relay) SetGravity(_ *context.T, _ rpc.ServerCall, g float32) error {
 	return nil
 }
 
+func (r *Relay) SetRoom(_ *context.T, _ rpc.ServerCall, wr ifc.Room) error {
+	r.roomMu.Lock()
+	r.room = DeserializeRoom(wr)
+	r.roomMu.Unlock()
+	go func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.acceptingData {
+			// Deliveries may overtake each other, so always pass on
+			// the latest room rather than this call's.
+			r.roomMu.Lock()
+			room := r.room
+			r.roomMu.Unlock()
+			if config.Chatty {
+				log.Printf("Relay: room = %v", room)
+			}
+			select {
+			case r.chRoom <- room:
+			case <-r.chDone:
+				return
+			}
+			if config.Chatty {
+				log.Printf("Relay: Passed in room.")
+			}
+		} else {
+			if config.Chatty {
+				log.Printf("Relay: Discarding room.")
+			}
+		}
+	}()
+	return nil
+}
+
+// Answered directly, so joiners can learn the room from anyone.
+func (r *Relay) GetRoom(_ *context.T, _ rpc.ServerCall) (ifc.Room, error) {
+	r.roomMu.Lock()
+	defer r.roomMu.Unlock()
+	return SerializeRoom(r.room), nil
+}
+
+// SetSize records the physical size of this player's screen, for
+// GetSize to answer with.
+func (r *Relay) SetSize(d model.Dimensions) {
+	r.roomMu.Lock()
+	defer r.roomMu.Unlock()
+	r.size = d
+}
+
+func (r *Relay) GetSize(_ *context.T, _ rpc.ServerCall) (ifc.Size, error) {
+	r.roomMu.Lock()
+	defer r.roomMu.Unlock()
+	return ifc.Size{r.size.W, r.size.H}, nil
+}
+
+// Asks the engine, as the reader of ChState, what it's up to.  An
+// engine that's busy, or not yet running, gets stateWait to answer.
+func (r *Relay) GetState(_ *context.T, _ rpc.ServerCall) (ifc.State, error) {
+	ch := make(chan model.State, 1)
+	timeout := time.After(stateWait)
+	select {
+	case r.chState <- ch:
+	case <-r.chDone:
+		return ifc.State{}, errNoState
+	case <-timeout:
+		return ifc.State{}, errNoState
+	}
+	select {
+	case s := <-ch:
+		return SerializeState(s), nil
+	case <-timeout:
+		return ifc.State{}, errNoState
+	}
+}
+
 func (r *Relay) Quit(_ *context.T, _ rpc.ServerCall) error {
 	go func() {
 		r.mu.Lock()
@@ -164,7 +285,11 @@ func (r *Relay) Quit(_ *context.T, _ rpc.ServerCall) error {
 			if config.Chatty {
 				log.Printf("Relay: Got a quit!.")
 			}
-			r.chQuit <- true
+			select {
+			case r.chQuit <- true:
+			case <-r.chDone:
+				return
+			}
 			if config.Chatty {
 				log.Printf("Relay: Passed quit to ch.")
 			}
@@ -177,6 +302,15 @@ func (r *Relay) Quit(_ *context.T, _ rpc.ServerCall) error {
 	return nil
 }
 
+// Answered directly, since it has to be quick to be useful.
+func (r *Relay) Now(_ *context.T, _ rpc.ServerCall) (int64, error) {
+	return time.Now().UnixNano(), nil
+}
+
+func (r *Relay) Ping(_ *context.T, _ rpc.ServerCall) error {
+	return nil
+}
+
 func (r *Relay) Recognize(_ *context.T, _ rpc.ServerCall, p ifc.Player) error {
 	go func() {
 		r.mu.Lock()
@@ -186,7 +320,11 @@ func (r *Relay) Recognize(_ *context.T, _ rpc.ServerCall, p ifc.Player) error {
 			if config.Chatty {
 				log.Printf("Relay: Must recognize player %v", player)
 			}
-			r.chRecognize <- player
+			select {
+			case r.chRecognize <- player:
+			case <-r.chDone:
+				return
+			}
 			if config.Chatty {
 				log.Printf("Relay: Recognize %v consumed.", player)
 			}
@@ -208,7 +346,11 @@ func (r *Relay) Forget(_ *context.T, _ rpc.ServerCall, p ifc.Player) error {
 			if config.Chatty {
 				log.Printf("Relay: Must forget player %v", player)
 			}
-			r.chForget <- player
+			select {
+			case r.chForget <- player:
+			case <-r.chDone:
+				return
+			}
 			if config.Chatty {
 				log.Printf("Relay: Forget %v consumed.", player)
 			}
@@ -222,19 +364,49 @@ func (r *Relay) Forget(_ *context.T, _ rpc.ServerCall, p ifc.Player) error {
 }
 
 func (r *Relay) Accept(_ *context.T, _ rpc.ServerCall, b ifc.Ball) error {
+	r.deliverBall(deserializeBall(b))
+	return nil
+}
+
+func (r *Relay) Deposit(_ *context.T, _ rpc.ServerCall, b ifc.Ball) error {
+	ball := deserializeBall(b)
+	ball.SetPos(config.MagicX, 0)
+	// Time spent on the way to the table isn't spent in flight.
+	ball.SetSentAt(time.Time{})
+	r.deliverBall(ball)
+	return nil
+}
+
+// Bounce hands back a ball that couldn't be thrown, so it enters the
+// local screen where it left, heading back the way it came.
+func (r *Relay) Bounce(bc model.BallCommand) {
+	b := bc.B
+	if bc.D.Horizontal() {
+		b.SetPos(1-b.GetPos().X, b.GetPos().Y)
+		b.SetVel(-b.GetVel().X, b.GetVel().Y)
+	} else {
+		b.SetPos(b.GetPos().X, 1-b.GetPos().Y)
+		b.SetVel(b.GetVel().X, -b.GetVel().Y)
+	}
+	if config.Chatty {
+		log.Printf("Relay: bouncing ball %v back from %v", b, bc.D)
+	}
+	r.deliverBall(b)
+}
+
+func (r *Relay) deliverBall(ball *model.Ball) {
 	go func() {
 		r.mu.Lock()
 		defer r.mu.Unlock()
 		if r.acceptingData {
-			player := model.NewPlayer(int(b.Owner.Id))
-			ball := model.NewBall(
-				player,
-				model.Vec{b.X, b.Y},
-				model.Vec{b.Dx, b.Dy})
 			if config.Chatty {
 				log.Printf("Relay: accepting ball %v", ball)
 			}
-			r.chBall <- ball
+			select {
+			case r.chBall <- ball:
+			case <-r.chDone:
+				return
+			}
 			if config.Chatty {
 				log.Printf("Relay: accepted  %v", ball)
 			}
@@ -244,5 +416,4 @@ func (r *Relay) Accept(_ *context.T, _ rpc.ServerCall, b ifc.Ball) error {
 			}
 		}
 	}()
-	return nil
 }
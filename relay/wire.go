@@ -0,0 +1,126 @@
+package relay
+
+import (
+	"github.com/monopole/volley/config"
+	"github.com/monopole/volley/ifc"
+	"github.com/monopole/volley/model"
+	"github.com/monopole/volley/topology"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// SerializeBall converts a ball to its wire form.
+func SerializeBall(b *model.Ball) ifc.Ball {
+	wp := ifc.Player{int32(b.Owner().Id())}
+	return ifc.Ball{
+		wp, b.GetPos().X, b.GetPos().Y, b.GetVel().X, b.GetVel().Y,
+		b.Aspect(), 0}
+}
+
+// HandoffBall serializes a ball thrown by player from through its door
+// in direction d to player to.  In a room with a layout, the ball is
+// mapped into the receiver's screen by where the two screens sit and
+// how big they are; see topology.Cross.
+func HandoffBall(
+	room model.Room, from, to int, bc model.BallCommand) ifc.Ball {
+	wb := SerializeBall(bc.B)
+	p, v, ok := topology.Cross(room, from, to, bc.D,
+		bc.B.GetPos(), bc.B.GetVel())
+	if ok {
+		wb.X, wb.Y, wb.Dx, wb.Dy = p.X, p.Y, v.X, v.Y
+		// Already fitted to the receiver's screen.
+		wb.Aspect = 0
+	}
+	return wb
+}
+
+func deserializeBall(b ifc.Ball) *model.Ball {
+	ball := model.NewBall(
+		model.NewPlayer(int(b.Owner.Id)),
+		model.Vec{b.X, b.Y},
+		model.Vec{b.Dx, b.Dy})
+	ball.SetAspect(b.Aspect)
+	if b.SentAt != 0 {
+		ball.SetSentAt(time.Unix(0, b.SentAt))
+	}
+	return ball
+}
+
+// FiredBall returns a ball owned by p that drops in from the center
+// of the top of the screen, heading in a random direction.
+func FiredBall(p *model.Player) ifc.Ball {
+	dx := rand.Float64()
+	dy := rand.Float64()
+	sign := rand.Float64()
+	if sign >= 0.5 {
+		dx = -dx
+	}
+	mag := math.Sqrt(dx*dx + dy*dy)
+	return SerializeBall(model.NewBall(p,
+		model.Vec{config.MagicX, 0},
+		model.Vec{float32(dx / mag), float32(dy / mag)}))
+}
+
+// SerializeRoom converts a room to its wire form.
+func SerializeRoom(r model.Room) ifc.Room {
+	slots := []ifc.Slot{}
+	for _, s := range r.Slots {
+		slots = append(slots, ifc.Slot{int32(s.Id), s.X, s.Y, s.W, s.H})
+	}
+	return ifc.Room{int32(r.Columns), r.Ring, slots}
+}
+
+// DeserializeRoom converts a room from its wire form.
+func DeserializeRoom(r ifc.Room) model.Room {
+	var slots []model.Slot
+	for _, s := range r.Slots {
+		slots = append(slots, model.Slot{int(s.Id), s.X, s.Y, s.W, s.H})
+	}
+	return model.Room{Columns: int(r.Columns), Ring: r.Ring, Slots: slots}
+}
+
+// SerializeState converts a player's state to its wire form.
+func SerializeState(s model.State) ifc.State {
+	balls := []ifc.Ball{}
+	for _, b := range s.Balls {
+		balls = append(balls, SerializeBall(b))
+	}
+	doors := []ifc.Door{}
+	for _, dc := range s.Doors {
+		doors = append(doors,
+			ifc.Door{int32(dc.D), dc.S == model.Open, dc.Lo, dc.Hi})
+	}
+	return ifc.State{
+		balls,
+		doors,
+		s.Gravity,
+		s.PauseDuration,
+		ifc.Size{s.Size.W, s.Size.H},
+		int64(s.Uptime),
+		s.Version,
+	}
+}
+
+// DeserializeState converts a player's state from its wire form.  The
+// state doesn't say whose it is.
+func DeserializeState(ws ifc.State) model.State {
+	s := model.State{
+		Gravity:       ws.Gravity,
+		PauseDuration: ws.PauseDuration,
+		Size:          model.Dimensions{ws.Size.W, ws.Size.H},
+		Uptime:        time.Duration(ws.Uptime),
+		Version:       ws.Version,
+	}
+	for _, b := range ws.Balls {
+		s.Balls = append(s.Balls, deserializeBall(b))
+	}
+	for _, d := range ws.Doors {
+		dc := model.DoorCommand{model.Closed, model.Direction(d.Dir), d.Lo, d.Hi}
+		if d.Open {
+			dc.S = model.Open
+		}
+		s.Doors = append(s.Doors, dc)
+	}
+	return s
+}
@@ -23,10 +23,11 @@ const (
 	// See coords.txt
 	vertexShader = `#version 100
 uniform vec2 jrOffset;
+uniform vec2 jrScale;
 attribute vec4 jrPosition;
 void main() {
 	vec4 offset4 = vec4(2.0*jrOffset.x-1.0, 1.0-2.0*jrOffset.y, 0, 0);
-	gl_Position = jrPosition + offset4;
+	gl_Position = vec4(jrPosition.xy*jrScale, jrPosition.zw) + offset4;
 }`
 
 	fragmentShader = `#version 100
@@ -63,6 +64,7 @@ type Screen struct {
 	program  gl.Program
 	position gl.Attrib
 	offset   gl.Uniform
+	scale    gl.Uniform
 	color    gl.Uniform
 	width    float32
 	height   float32
@@ -70,22 +72,15 @@ type Screen struct {
 
 var triangleData []byte
 
-// Characteristic values of an equilateral triangle in opengl window
-// coords.  The base of such a window is two 'units' wide (-1..1), so
-// a triangle with side == 2 just fits inside a window.
-func computeTriangleLengths() (float32, float32) {
-	side := 2.0 / 8.0 // Take a fraction of two, the characteristic size.
-	halfBase := side / 2.0
-	halfHeight := math.Sqrt(side*side-halfBase*halfBase) / 2.0
-	return float32(halfBase), float32(halfHeight)
-}
-
+// An equilateral triangle inscribed in a unit circle.  The shader
+// scales it so the circle has the ball's radius on screen, which is
+// also the radius physics uses for collisions.
 func makeTriangleData() []byte {
-	halfBase, halfHeight := computeTriangleLengths()
+	halfBase := float32(math.Sqrt(3) / 2)
 	return f32.Bytes(binary.LittleEndian,
-		-halfBase, -halfHeight, 0.0,
-		0.0, halfHeight, 0.0,
-		halfBase, -halfHeight, 0.0,
+		-halfBase, -0.5, 0.0,
+		0.0, 1.0, 0.0,
+		halfBase, -0.5, 0.0,
 	)
 }
 
@@ -122,6 +117,7 @@ func (s *Screen) Start() {
 	s.position = s.glctx.GetAttribLocation(s.program, "jrPosition")
 	s.color = s.glctx.GetUniformLocation(s.program, "jrColor")
 	s.offset = s.glctx.GetUniformLocation(s.program, "jrOffset")
+	s.scale = s.glctx.GetUniformLocation(s.program, "jrScale")
 	s.glctx.UseProgram(s.program)
 }
 
@@ -147,10 +143,17 @@ func (s *Screen) Paint(balls []*model.Ball) {
 	s.Clear()
 	s.glctx.EnableVertexAttribArray(s.position)
 	s.glctx.VertexAttribPointer(s.position, coordsPerVertex, gl.FLOAT, false, 0, 0)
+	side := s.width
+	if s.height < side {
+		side = s.height
+	}
 	for _, b := range balls {
 		c := playerColors[b.Owner().Id()%len(playerColors)]
 		s.glctx.Uniform4f(s.color, c.R, c.G, c.B, opaque)
 		s.glctx.Uniform2f(s.offset, b.GetPos().X/s.width, b.GetPos().Y/s.height)
+		// OpenGL spans two units across the window.
+		r := b.Radius() * side
+		s.glctx.Uniform2f(s.scale, 2*r/s.width, 2*r/s.height)
 		s.glctx.DrawArrays(gl.TRIANGLES, 0, vertexCount)
 	}
 	s.glctx.DisableVertexAttribArray(s.position)
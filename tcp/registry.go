@@ -0,0 +1,192 @@
+// Package tcp connects players with JSON-RPC over plain TCP, for
+// networks where v23 credentials aren't to be had.
+//
+// A Registry, run by the first player or the master at the namespace
+// root, stands in for the mounttable: players join it to get an id and
+// to say where they listen, and look each other up in it.  After that
+// players call each other directly, each serving its relay.  Players
+// renew their listing as they go, so one that crashes is dropped.
+package tcp
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"sort"
+	"sync"
+	"time"
+)
+
+// How long a player stays listed without renewing.  A player that
+// crashes, rather than leaving, drops out of the registry this long
+// after its last renewal.
+const lease = 15 * time.Second
+
+// The argument or reply of calls that need none.
+type Empty struct{}
+
+type JoinArgs struct {
+	Addr string // Where the joiner listens, as host:port.
+}
+
+type JoinReply struct {
+	Id     int
+	Others []int // Sorted.
+}
+
+type RenewArgs struct {
+	Id   int
+	Addr string // As given to Join.
+}
+
+// Registry hands out player ids, and knows where each player listens.
+// Players stay listed while they renew within the lease.
+type Registry struct {
+	mu    sync.Mutex
+	addrs map[int]string
+	seen  map[int]time.Time // Last join or renewal.
+	lease time.Duration
+	now   func() time.Time
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		sync.Mutex{},
+		make(map[int]string),
+		make(map[int]time.Time),
+		lease,
+		time.Now,
+	}
+}
+
+// Join gives the caller the id one above every id in use.  Joins are
+// taken one at a time, so no two players get the same id, and each
+// sees all who joined before it.
+func (r *Registry) Join(args JoinArgs, reply *JoinReply) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reply.Others = r.ids()
+	reply.Id = 1
+	for _, id := range reply.Others {
+		if id >= reply.Id {
+			reply.Id = id + 1
+		}
+	}
+	r.addrs[reply.Id] = args.Addr
+	r.seen[reply.Id] = r.now()
+	return nil
+}
+
+// Renew keeps the caller listed for another lease.  A player whose
+// lease ran out, say after a long stall, is listed again, unless its
+// id went to someone else meanwhile.
+func (r *Registry) Renew(args RenewArgs, _ *Empty) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expire()
+	if a, ok := r.addrs[args.Id]; ok && a != args.Addr {
+		return fmt.Errorf("id %d belongs to %s", args.Id, a)
+	}
+	r.addrs[args.Id] = args.Addr
+	r.seen[args.Id] = r.now()
+	return nil
+}
+
+func (r *Registry) Leave(id int, _ *Empty) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.addrs, id)
+	delete(r.seen, id)
+	return nil
+}
+
+func (r *Registry) List(_ Empty, ids *[]int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	*ids = r.ids()
+	return nil
+}
+
+// Lookup returns where the given player listens.
+func (r *Registry) Lookup(id int, addr *string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expire()
+	a, ok := r.addrs[id]
+	if !ok {
+		return fmt.Errorf("no player %d", id)
+	}
+	*addr = a
+	return nil
+}
+
+// The ids of players whose lease hasn't run out.
+func (r *Registry) ids() []int {
+	r.expire()
+	ids := []int{}
+	for id := range r.addrs {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// Forget players that haven't renewed within the lease.
+func (r *Registry) expire() {
+	now := r.now()
+	for id, t := range r.seen {
+		if now.Sub(t) > r.lease {
+			log.Printf("Player %d let its lease lapse; dropping it.", id)
+			delete(r.addrs, id)
+			delete(r.seen, id)
+		}
+	}
+}
+
+// Serves JSON-RPC calls on the connections a listener accepts.
+type server struct {
+	l     net.Listener
+	mu    sync.Mutex
+	conns map[net.Conn]bool
+}
+
+// Serve calls to rcvr, under the given name, on connections accepted
+// by l, until closed.
+func serve(l net.Listener, name string, rcvr interface{}) (*server, error) {
+	s := rpc.NewServer()
+	if err := s.RegisterName(name, rcvr); err != nil {
+		return nil, err
+	}
+	srv := &server{l, sync.Mutex{}, make(map[net.Conn]bool)}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				log.Printf("%s stopped listening: %v", name, err)
+				return
+			}
+			srv.mu.Lock()
+			srv.conns[conn] = true
+			srv.mu.Unlock()
+			go func() {
+				s.ServeCodec(jsonrpc.NewServerCodec(conn))
+				srv.mu.Lock()
+				delete(srv.conns, conn)
+				srv.mu.Unlock()
+			}()
+		}
+	}()
+	return srv, nil
+}
+
+// Stop listening, and hang up on everyone connected.
+func (srv *server) Close() {
+	srv.l.Close()
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for conn := range srv.conns {
+		conn.Close()
+	}
+}
@@ -0,0 +1,399 @@
+package tcp
+
+import (
+	"fmt"
+	"github.com/monopole/volley/discovery"
+	"github.com/monopole/volley/ifc"
+	"github.com/monopole/volley/peer"
+	"github.com/monopole/volley/relay"
+	"log"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"sync"
+	"time"
+)
+
+const (
+	// How long a connection may take to open.
+	dialTimeout = 5 * time.Second
+	// How long a call may take, but for pings, which say how long.
+	callTimeout = 5 * time.Second
+	// How often a joined player renews its listing.
+	renewEvery = lease / 3
+)
+
+// Transport is a peer.Transport over JSON-RPC.
+type Transport struct {
+	chatty        bool
+	isGameMaster  bool
+	root          string // The registry, as host:port.
+	hostsRegistry bool
+	// Where others reach this player, given the port it listens on.
+	advertise func(port string) string
+	// Remember and announce the root; see discovery.Publish.
+	publish  func(root string) (*discovery.Beacon, error)
+	registry *rpc.Client
+	servers  []*server // Closed by Close.
+	beacon   *discovery.Beacon
+	myId     int       // Given by Join.
+	stop     chan bool // Closed to stop renewing the listing.
+}
+
+func NewTransport(
+	chatty bool,
+	isGameMaster bool,
+	root string,
+	hostsRegistry bool) *Transport {
+	return &Transport{
+		chatty,
+		isGameMaster,
+		root,
+		hostsRegistry,
+		discovery.LocalRoot,
+		func(root string) (*discovery.Beacon, error) {
+			return discovery.Publish(root, isGameMaster)
+		},
+		nil, // registry
+		nil, // servers
+		nil, // beacon
+		0,   // myId
+		nil, // stop
+	}
+}
+
+// NewManager returns a manager for a player reaching the others
+// through the registry at root, as host:port, running the registry
+// itself if hostsRegistry.
+func NewManager(
+	chatty bool,
+	isGameMaster bool,
+	root string,
+	hostsRegistry bool) *peer.Manager {
+	return peer.NewManager(chatty, isGameMaster,
+		NewTransport(chatty, isGameMaster, root, hostsRegistry))
+}
+
+// Root is the registry's address, known once Open returns.
+func (t *Transport) Root() string {
+	return t.root
+}
+
+func (t *Transport) Open() error {
+	if t.hostsRegistry {
+		if err := t.hostRegistry(); err != nil {
+			return fmt.Errorf("unable to host the registry: %v", err)
+		}
+	}
+	conn, err := net.DialTimeout("tcp", t.root, dialTimeout)
+	if err != nil {
+		return err
+	}
+	t.registry = jsonrpc.NewClient(conn)
+	return nil
+}
+
+// Run a registry in this process, at the port of the root, and
+// announce it at once.  A root at port 0 is wherever the listener
+// lands.
+func (t *Transport) hostRegistry() error {
+	host, port, err := net.SplitHostPort(t.root)
+	if err != nil {
+		return err
+	}
+	l, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return err
+	}
+	srv, err := serve(l, "Registry", NewRegistry())
+	if err != nil {
+		l.Close()
+		return err
+	}
+	t.servers = append(t.servers, srv)
+	_, port, _ = net.SplitHostPort(l.Addr().String())
+	t.root = net.JoinHostPort(host, port)
+	if t.chatty {
+		log.Printf("Registry running at %s", t.root)
+	}
+	t.announceRoot()
+	return nil
+}
+
+func (t *Transport) announceRoot() {
+	b, err := t.publish(t.root)
+	if err != nil {
+		log.Printf("Unable to announce registry: %v", err)
+		return
+	}
+	t.beacon = b
+}
+
+func (t *Transport) List() (ids []int, err error) {
+	err = call(t.registry, callTimeout, "Registry.List", Empty{}, &ids)
+	return
+}
+
+func (t *Transport) Join(r *relay.Relay) (int, []int, error) {
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		return 0, nil, err
+	}
+	srv, err := serve(l, "Game", &game{r})
+	if err != nil {
+		l.Close()
+		return 0, nil, err
+	}
+	t.servers = append(t.servers, srv)
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	addr := t.advertise(port)
+	var reply JoinReply
+	err = call(t.registry, callTimeout, "Registry.Join", JoinArgs{addr}, &reply)
+	if err != nil {
+		return 0, nil, err
+	}
+	if t.chatty {
+		log.Printf("Player %d listening at %s", reply.Id, addr)
+	}
+	t.myId = reply.Id
+	if t.beacon == nil {
+		t.announceRoot()
+	}
+	t.stop = make(chan bool)
+	go t.renew(RenewArgs{reply.Id, addr}, t.stop)
+	return reply.Id, reply.Others, nil
+}
+
+// Keep this player listed until stop is closed.
+func (t *Transport) renew(args RenewArgs, stop chan bool) {
+	ticker := time.NewTicker(renewEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			err := call(t.registry, callTimeout, "Registry.Renew", args, &Empty{})
+			if err != nil {
+				log.Printf("Unable to renew player %d: %v", args.Id, err)
+			}
+		}
+	}
+}
+
+func (t *Transport) stopRenewing() {
+	if t.stop != nil {
+		close(t.stop)
+		t.stop = nil
+	}
+}
+
+func (t *Transport) Leave() error {
+	t.stopRenewing()
+	return call(t.registry, callTimeout, "Registry.Leave", t.myId, &Empty{})
+}
+
+func (t *Transport) Dial(id int) peer.Peer {
+	return &tcpPeer{t, id, sync.Mutex{}, nil}
+}
+
+func (t *Transport) Close() {
+	t.stopRenewing()
+	if t.beacon != nil {
+		t.beacon.Stop()
+	}
+	if t.registry != nil {
+		t.registry.Close()
+	}
+	for _, srv := range t.servers {
+		srv.Close()
+	}
+}
+
+// Make a call, giving up after wait.
+func call(c *rpc.Client,
+	wait time.Duration, method string, args, reply interface{}) error {
+	select {
+	case done := <-c.Go(method, args, reply, nil).Done:
+		return done.Error
+	case <-time.After(wait):
+		return fmt.Errorf("%s timed out after %v", method, wait)
+	}
+}
+
+// A player as reached through its game service.  The connection is
+// opened on the first call, and again after one that failed.
+type tcpPeer struct {
+	t  *Transport
+	id int
+	mu sync.Mutex
+	c  *rpc.Client
+}
+
+func (p *tcpPeer) client() (*rpc.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.c != nil {
+		return p.c, nil
+	}
+	var addr string
+	err := call(p.t.registry, callTimeout, "Registry.Lookup", p.id, &addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	p.c = jsonrpc.NewClient(conn)
+	return p.c, nil
+}
+
+// Drop c, unless a later call already has.
+func (p *tcpPeer) drop(c *rpc.Client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.c == c {
+		p.c = nil
+	}
+	c.Close()
+}
+
+func (p *tcpPeer) call(
+	wait time.Duration, method string, args, reply interface{}) error {
+	c, err := p.client()
+	if err != nil {
+		return err
+	}
+	err = call(c, wait, "Game."+method, args, reply)
+	if _, ok := err.(rpc.ServerError); err != nil && !ok {
+		// Not the player's answer, so the connection is suspect.
+		p.drop(c)
+	}
+	return err
+}
+
+func (p *tcpPeer) Recognize(wp ifc.Player) error {
+	return p.call(callTimeout, "Recognize", wp, &Empty{})
+}
+
+func (p *tcpPeer) Forget(wp ifc.Player) error {
+	return p.call(callTimeout, "Forget", wp, &Empty{})
+}
+
+func (p *tcpPeer) Accept(b ifc.Ball) error {
+	return p.call(callTimeout, "Accept", b, &Empty{})
+}
+
+func (p *tcpPeer) Deposit(b ifc.Ball) error {
+	return p.call(callTimeout, "Deposit", b, &Empty{})
+}
+
+func (p *tcpPeer) Quit() error {
+	return p.call(callTimeout, "Quit", Empty{}, &Empty{})
+}
+
+func (p *tcpPeer) Now() (then int64, err error) {
+	err = p.call(callTimeout, "Now", Empty{}, &then)
+	return
+}
+
+func (p *tcpPeer) Ping(wait time.Duration) error {
+	return p.call(wait, "Ping", Empty{}, &Empty{})
+}
+
+func (p *tcpPeer) DoMasterCommand(mc ifc.MasterCommand) error {
+	return p.call(callTimeout, "DoMasterCommand", mc, &Empty{})
+}
+
+func (p *tcpPeer) SetPauseDuration(pd float32) error {
+	return p.call(callTimeout, "SetPauseDuration", pd, &Empty{})
+}
+
+func (p *tcpPeer) SetGravity(g float32) error {
+	return p.call(callTimeout, "SetGravity", g, &Empty{})
+}
+
+func (p *tcpPeer) SetRoom(wr ifc.Room) error {
+	return p.call(callTimeout, "SetRoom", wr, &Empty{})
+}
+
+func (p *tcpPeer) GetRoom() (wr ifc.Room, err error) {
+	err = p.call(callTimeout, "GetRoom", Empty{}, &wr)
+	return
+}
+
+func (p *tcpPeer) GetSize() (ws ifc.Size, err error) {
+	err = p.call(callTimeout, "GetSize", Empty{}, &ws)
+	return
+}
+
+func (p *tcpPeer) GetState() (ws ifc.State, err error) {
+	err = p.call(callTimeout, "GetState", Empty{}, &ws)
+	return
+}
+
+// Serves a player's relay.
+type game struct {
+	r *relay.Relay
+}
+
+func (g *game) Recognize(wp ifc.Player, _ *Empty) error {
+	return g.r.Recognize(nil, nil, wp)
+}
+
+func (g *game) Forget(wp ifc.Player, _ *Empty) error {
+	return g.r.Forget(nil, nil, wp)
+}
+
+func (g *game) Accept(b ifc.Ball, _ *Empty) error {
+	return g.r.Accept(nil, nil, b)
+}
+
+func (g *game) Deposit(b ifc.Ball, _ *Empty) error {
+	return g.r.Deposit(nil, nil, b)
+}
+
+func (g *game) Quit(_ Empty, _ *Empty) error {
+	return g.r.Quit(nil, nil)
+}
+
+func (g *game) Now(_ Empty, now *int64) (err error) {
+	*now, err = g.r.Now(nil, nil)
+	return
+}
+
+func (g *game) Ping(_ Empty, _ *Empty) error {
+	return g.r.Ping(nil, nil)
+}
+
+func (g *game) DoMasterCommand(mc ifc.MasterCommand, _ *Empty) error {
+	return g.r.DoMasterCommand(nil, nil, mc)
+}
+
+func (g *game) SetPauseDuration(pd float32, _ *Empty) error {
+	return g.r.SetPauseDuration(nil, nil, pd)
+}
+
+func (g *game) SetGravity(gr float32, _ *Empty) error {
+	return g.r.SetGravity(nil, nil, gr)
+}
+
+func (g *game) SetRoom(wr ifc.Room, _ *Empty) error {
+	return g.r.SetRoom(nil, nil, wr)
+}
+
+func (g *game) GetRoom(_ Empty, wr *ifc.Room) (err error) {
+	*wr, err = g.r.GetRoom(nil, nil)
+	return
+}
+
+func (g *game) GetSize(_ Empty, ws *ifc.Size) (err error) {
+	*ws, err = g.r.GetSize(nil, nil)
+	return
+}
+
+func (g *game) GetState(_ Empty, ws *ifc.State) (err error) {
+	*ws, err = g.r.GetState(nil, nil)
+	return
+}
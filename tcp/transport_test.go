@@ -0,0 +1,128 @@
+package tcp
+
+import (
+	"github.com/monopole/volley/discovery"
+	"github.com/monopole/volley/ifc"
+	"github.com/monopole/volley/model"
+	"github.com/monopole/volley/relay"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// A transport on loopback that announces nothing.
+func testTransport(t *testing.T, root string, host bool) *Transport {
+	tr := NewTransport(false, false, root, host)
+	tr.advertise = func(port string) string {
+		return net.JoinHostPort("127.0.0.1", port)
+	}
+	tr.publish = func(string) (*discovery.Beacon, error) {
+		return nil, nil
+	}
+	if err := tr.Open(); err != nil {
+		t.Fatalf("unable to open transport: %v", err)
+	}
+	return tr
+}
+
+func TestJoinTakesNextId(t *testing.T) {
+	host := testTransport(t, "127.0.0.1:0", true)
+	defer host.Close()
+	if ids, err := host.List(); err != nil || len(ids) != 0 {
+		t.Errorf("got %v, %v; want no players", ids, err)
+	}
+	t1 := testTransport(t, host.Root(), false)
+	defer t1.Close()
+	t2 := testTransport(t, host.Root(), false)
+	defer t2.Close()
+	if id, others, err := t1.Join(relay.MakeRelay()); err != nil ||
+		id != 1 || len(others) != 0 {
+		t.Errorf("got %d, %v, %v; want 1 and no others", id, others, err)
+	}
+	if id, others, err := t2.Join(relay.MakeRelay()); err != nil ||
+		id != 2 || !reflect.DeepEqual(others, []int{1}) {
+		t.Errorf("got %d, %v, %v; want 2 and [1]", id, others, err)
+	}
+	if err := t1.Leave(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ids, err := host.List(); err != nil || !reflect.DeepEqual(ids, []int{2}) {
+		t.Errorf("got %v, %v; want [2]", ids, err)
+	}
+}
+
+func TestCallsReachRelay(t *testing.T) {
+	host := testTransport(t, "127.0.0.1:0", true)
+	defer host.Close()
+	t1 := testTransport(t, host.Root(), false)
+	r1 := relay.MakeRelay()
+	id, _, err := t1.Join(r1)
+	if err != nil {
+		t.Fatalf("unable to join: %v", err)
+	}
+	r1.SetSize(model.Dimensions{60, 80})
+
+	p := host.Dial(id)
+	if err := p.Ping(time.Second); err != nil {
+		t.Errorf("ping failed: %v", err)
+	}
+	if ws, err := p.GetSize(); err != nil || ws != (ifc.Size{60, 80}) {
+		t.Errorf("got size %v, %v; want 60x80", ws, err)
+	}
+	if err := p.SetGravity(3); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	select {
+	case g := <-r1.ChGravity():
+		if g != 3 {
+			t.Errorf("got gravity %.2f, want 3", g)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("gravity never arrived")
+	}
+
+	t1.Close()
+	if err := p.Ping(time.Second); err == nil {
+		t.Errorf("ping of a closed player should fail")
+	}
+}
+
+func TestUnrenewedPlayersLapse(t *testing.T) {
+	r := NewRegistry()
+	now := time.Unix(0, 0)
+	r.now = func() time.Time { return now }
+	var reply JoinReply
+	r.Join(JoinArgs{"a:1"}, &reply)
+	r.Join(JoinArgs{"b:2"}, &reply)
+
+	// Player 1 renews; player 2 has crashed.
+	now = now.Add(lease / 2)
+	if err := r.Renew(RenewArgs{1, "a:1"}, &Empty{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now = now.Add(lease/2 + time.Second)
+	var ids []int
+	if r.List(Empty{}, &ids); !reflect.DeepEqual(ids, []int{1}) {
+		t.Errorf("got %v; want [1]", ids)
+	}
+	var addr string
+	if err := r.Lookup(2, &addr); err == nil {
+		t.Errorf("got %s for a lapsed player; want an error", addr)
+	}
+	if r.Join(JoinArgs{"c:3"}, &reply); reply.Id != 2 {
+		t.Errorf("got id %d; want the lapsed id 2 back", reply.Id)
+	}
+
+	// A stalled player is listed again when it renews, if its id is free.
+	now = now.Add(2 * lease)
+	if err := r.Renew(RenewArgs{1, "a:1"}, &Empty{}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := r.Renew(RenewArgs{1, "d:4"}, &Empty{}); err == nil {
+		t.Errorf("renewed someone else's id; want an error")
+	}
+	if r.List(Empty{}, &ids); !reflect.DeepEqual(ids, []int{1}) {
+		t.Errorf("got %v; want [1]", ids)
+	}
+}
@@ -0,0 +1,369 @@
+// Package topology decides which players are next to each other.
+//
+// In a room with a layout, players stand where their slots put them.
+// Otherwise players fill a grid row by row, left to right and top to
+// bottom, in order of id; see model.Room.  Each player has a door on
+// every edge, open if somebody stands on that side, or, in a ring, at
+// the far end of the row or column.
+package topology
+
+import (
+	"github.com/monopole/volley/model"
+	"sort"
+)
+
+// Where a player stands in the grid.
+type cell struct {
+	row int
+	col int
+}
+
+// Lay out the players with the given ids, in any order, in the room.
+func place(room model.Room, ids []int) map[cell]int {
+	sorted := append([]int{}, ids...)
+	sort.Ints(sorted)
+	grid := make(map[cell]int)
+	for i, id := range sorted {
+		if room.Columns > 0 {
+			grid[cell{i / room.Columns, i % room.Columns}] = id
+		} else {
+			grid[cell{0, i}] = id
+		}
+	}
+	return grid
+}
+
+// The cell next to c in direction d.
+func (c cell) step(d model.Direction) cell {
+	switch d {
+	case model.Left:
+		c.col--
+	case model.Right:
+		c.col++
+	case model.Up:
+		c.row--
+	case model.Down:
+		c.row++
+	}
+	return c
+}
+
+// Neighbor returns the id of the player next to player me in direction
+// d, given the ids of all the other players in any order.  The bool is
+// false if nobody is there.  In a ring, the player at the end of a row
+// or column has the player at the other end as a neighbor, unless it
+// stands alone.
+func Neighbor(
+	room model.Room, me int, others []int, d model.Direction) (int, bool) {
+	if len(room.Slots) > 0 {
+		return slotNeighbor(room, me, others, d)
+	}
+	grid := place(room, append([]int{me}, others...))
+	for c, id := range grid {
+		if id != me {
+			continue
+		}
+		if id, ok := grid[c.step(d)]; ok {
+			return id, true
+		}
+		if !room.Ring {
+			return 0, false
+		}
+		// Walk back to the far end of the row or column.
+		far := c
+		for {
+			if _, ok := grid[far.step(d.Opposite())]; !ok {
+				break
+			}
+			far = far.step(d.Opposite())
+		}
+		if far == c {
+			return 0, false
+		}
+		return grid[far], true
+	}
+	return 0, false
+}
+
+// Doors returns a command for each of player me's doors, open if
+// there's a neighbor on that side and closed otherwise.  In a room
+// with a layout, a door spans only the part of the edge facing the
+// neighbor's screen.
+func Doors(room model.Room, me int, others []int) []model.DoorCommand {
+	dcs := []model.DoorCommand{}
+	for _, d := range model.Directions {
+		id, ok := Neighbor(room, me, others, d)
+		if !ok {
+			dcs = append(dcs, model.WholeDoor(model.Closed, d))
+			continue
+		}
+		dc := model.WholeDoor(model.Open, d)
+		mine, ok1 := room.Slot(me)
+		theirs, ok2 := room.Slot(id)
+		if ok1 && ok2 {
+			dc.Lo, dc.Hi = span(mine, theirs, d)
+		}
+		dcs = append(dcs, dc)
+	}
+	return dcs
+}
+
+// Cross maps a ball leaving player from by its door in direction d
+// into the screen of player to.  Positions are fractions of a screen,
+// and velocities relative to a screen's size, as in a ball handed
+// between players.  In a room with a layout, the ball keeps its place
+// and its speed in the room, so it crosses seamlessly between screens
+// of different sizes and heights.  The bool is false, and nothing
+// changed, unless both players have slots.
+func Cross(room model.Room, from, to int, d model.Direction,
+	p, v model.Vec) (model.Vec, model.Vec, bool) {
+	a, ok1 := room.Slot(from)
+	b, ok2 := room.Slot(to)
+	if !ok1 || !ok2 || b.W <= 0 || b.H <= 0 {
+		return p, v, false
+	}
+	x := (a.X + p.X*a.W - b.X) / b.W
+	y := (a.Y + p.Y*a.H - b.Y) / b.H
+	// Enter by the facing edge, even across a ring.
+	switch d {
+	case model.Left:
+		x = 1
+	case model.Right:
+		x = 0
+	case model.Up:
+		y = 1
+	case model.Down:
+		y = 0
+	}
+	return model.Vec{clamp(x), clamp(y)},
+		model.Vec{v.X * a.W / b.W, v.Y * a.H / b.H}, true
+}
+
+func clamp(f float32) float32 {
+	if f < 0 {
+		return 0
+	}
+	if f > 1 {
+		return 1
+	}
+	return f
+}
+
+// How far slot b lies beyond slot a in direction d, edge to edge.
+// Negative if they overlap.
+func gap(a, b model.Slot, d model.Direction) float32 {
+	switch d {
+	case model.Left:
+		return a.X - (b.X + b.W)
+	case model.Right:
+		return b.X - (a.X + a.W)
+	case model.Up:
+		return a.Y - (b.Y + b.H)
+	default:
+		return b.Y - (a.Y + a.H)
+	}
+}
+
+// How much of the edges of slots a and b facing direction d line up.
+func overlap(a, b model.Slot, d model.Direction) float32 {
+	lo, hi := a.Y, a.Y+a.H
+	blo, bhi := b.Y, b.Y+b.H
+	if !d.Horizontal() {
+		lo, hi = a.X, a.X+a.W
+		blo, bhi = b.X, b.X+b.W
+	}
+	if blo > lo {
+		lo = blo
+	}
+	if bhi < hi {
+		hi = bhi
+	}
+	return hi - lo
+}
+
+// The part of slot a's edge in direction d that faces slot b, as
+// fractions of the edge from its left or top end.
+func span(a, b model.Slot, d model.Direction) (float32, float32) {
+	lo, hi, length := b.Y-a.Y, b.Y+b.H-a.Y, a.H
+	if !d.Horizontal() {
+		lo, hi, length = b.X-a.X, b.X+b.W-a.X, a.W
+	}
+	if length <= 0 {
+		return 0, 1
+	}
+	return clamp(lo / length), clamp(hi / length)
+}
+
+// Whether the middle of slot b is beyond the middle of slot a in
+// direction d.
+func ahead(a, b model.Slot, d model.Direction) bool {
+	switch d {
+	case model.Left:
+		return b.X+b.W/2 < a.X+a.W/2
+	case model.Right:
+		return b.X+b.W/2 > a.X+a.W/2
+	case model.Up:
+		return b.Y+b.H/2 < a.Y+a.H/2
+	default:
+		return b.Y+b.H/2 > a.Y+a.H/2
+	}
+}
+
+// Whether, seen from slot a in direction d, slot b is a better
+// neighbor than slot c: nearer, then more lined up, then lower id.
+func better(a, b, c model.Slot, d model.Direction) bool {
+	if gb, gc := gap(a, b, d), gap(a, c, d); gb != gc {
+		return gb < gc
+	}
+	if ob, oc := overlap(a, b, d), overlap(a, c, d); ob != oc {
+		return ob > oc
+	}
+	return b.Id < c.Id
+}
+
+// The neighbor in a room with a layout is the nearest live player in
+// direction d whose facing edge lines up with some of ours.  In a ring,
+// failing that, it's the farthest such player the other way.
+func slotNeighbor(
+	room model.Room, me int, others []int, d model.Direction) (int, bool) {
+	mine, ok := room.Slot(me)
+	if !ok {
+		return 0, false
+	}
+	live := map[int]bool{}
+	for _, id := range others {
+		live[id] = true
+	}
+	facing := func(s model.Slot, d model.Direction) bool {
+		return live[s.Id] && s.Id != me &&
+			overlap(mine, s, d) > 0 && ahead(mine, s, d)
+	}
+	var best model.Slot
+	found := false
+	for _, s := range room.Slots {
+		if facing(s, d) && (!found || better(mine, s, best, d)) {
+			best, found = s, true
+		}
+	}
+	if found || !room.Ring {
+		return best.Id, found
+	}
+	back := d.Opposite()
+	for _, s := range room.Slots {
+		if facing(s, back) && (!found || better(mine, best, s, back)) {
+			best, found = s, true
+		}
+	}
+	return best.Id, found
+}
+
+// Rows returns the players with the given ids, in any order, as they
+// stand in the room: row by row from the top, each row from the left.
+// In a room with a layout, a player starts a new row unless the middle
+// of its slot is level with the first slot of the row, and players
+// without slots stand apart, in a last row of their own.
+func Rows(room model.Room, ids []int) [][]int {
+	sorted := append([]int{}, ids...)
+	sort.Ints(sorted)
+	rows := [][]int{}
+	if len(room.Slots) == 0 {
+		n := room.Columns
+		if n <= 0 {
+			n = len(sorted)
+		}
+		for len(sorted) > 0 {
+			if n > len(sorted) {
+				n = len(sorted)
+			}
+			rows = append(rows, sorted[:n])
+			sorted = sorted[n:]
+		}
+		return rows
+	}
+	slots := []model.Slot{}
+	apart := []int{}
+	for _, id := range sorted {
+		if s, ok := room.Slot(id); ok {
+			slots = append(slots, s)
+		} else {
+			apart = append(apart, id)
+		}
+	}
+	sort.Sort(byMiddle(slots))
+	var first model.Slot
+	var row []model.Slot
+	for i, s := range slots {
+		mid := s.Y + s.H/2
+		if i > 0 && (mid < first.Y || mid > first.Y+first.H) {
+			rows = append(rows, leftToRight(row))
+			row = nil
+		}
+		if row == nil {
+			first = s
+		}
+		row = append(row, s)
+	}
+	if len(row) > 0 {
+		rows = append(rows, leftToRight(row))
+	}
+	if len(apart) > 0 {
+		rows = append(rows, apart)
+	}
+	return rows
+}
+
+// Picks is true if target t picks player me, given the ids of all the
+// other players in any order.  The left half of the room is the left
+// half of each row; in a grid, the grid's columns, even in a last row
+// that's short.  A player standing in the middle of an odd row is in
+// neither half.
+func Picks(room model.Room, t model.Target, me int, others []int) bool {
+	if !t.PicksId(me) {
+		return false
+	}
+	if t.Half == model.Whole {
+		return true
+	}
+	for _, row := range Rows(room, append([]int{me}, others...)) {
+		w := len(row)
+		if len(room.Slots) == 0 && room.Columns > 0 {
+			w = room.Columns
+		}
+		for i, id := range row {
+			if id != me {
+				continue
+			}
+			if t.Half == model.LeftHalf {
+				return 2*i+1 < w
+			}
+			return 2*i+1 > w
+		}
+	}
+	return false
+}
+
+// The ids of a row of slots, from the left.
+func leftToRight(row []model.Slot) []int {
+	sort.Sort(byLeft(row))
+	ids := make([]int, len(row))
+	for i, s := range row {
+		ids[i] = s.Id
+	}
+	return ids
+}
+
+// Slots by the height of their middles, from the top.
+type byMiddle []model.Slot
+
+func (s byMiddle) Len() int      { return len(s) }
+func (s byMiddle) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byMiddle) Less(i, j int) bool {
+	return s[i].Y+s[i].H/2 < s[j].Y+s[j].H/2
+}
+
+// Slots by their left edges.
+type byLeft []model.Slot
+
+func (s byLeft) Len() int           { return len(s) }
+func (s byLeft) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byLeft) Less(i, j int) bool { return s[i].X < s[j].X }
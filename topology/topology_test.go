@@ -0,0 +1,351 @@
+package topology
+
+import (
+	"github.com/monopole/volley/model"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestNeighbor(t *testing.T) {
+	others := []int{7, 2, 9, 4}
+	cases := []struct {
+		me   int
+		d    model.Direction
+		want int
+		ok   bool
+	}{
+		{5, model.Left, 4, true},
+		{5, model.Right, 7, true},
+		{5, model.Up, 0, false},
+		{5, model.Down, 0, false},
+		{1, model.Left, 0, false},
+		{1, model.Right, 2, true},
+		{10, model.Right, 0, false},
+		{10, model.Left, 9, true},
+	}
+	for _, c := range cases {
+		got, ok := Neighbor(model.Room{}, c.me, others, c.d)
+		if ok != c.ok || got != c.want {
+			t.Errorf("Neighbor(%d, %v) = %d, %v; want %d, %v",
+				c.me, c.d, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+// Seven players in rows of three:
+//
+//	1 2 3
+//	4 5 6
+//	7
+func TestGridNeighbor(t *testing.T) {
+	room := model.Room{Columns: 3}
+	all := []int{1, 2, 3, 4, 5, 6, 7}
+	cases := []struct {
+		me   int
+		d    model.Direction
+		want int
+		ok   bool
+	}{
+		{5, model.Left, 4, true},
+		{5, model.Right, 6, true},
+		{5, model.Up, 2, true},
+		{5, model.Down, 0, false},
+		{4, model.Down, 7, true},
+		{3, model.Right, 0, false},
+		{4, model.Left, 0, false},
+		{2, model.Up, 0, false},
+		{7, model.Right, 0, false},
+	}
+	for _, c := range cases {
+		others := []int{}
+		for _, id := range all {
+			if id != c.me {
+				others = append(others, id)
+			}
+		}
+		got, ok := Neighbor(room, c.me, others, c.d)
+		if ok != c.ok || got != c.want {
+			t.Errorf("Neighbor(%d, %v) = %d, %v; want %d, %v",
+				c.me, c.d, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestRingNeighbor(t *testing.T) {
+	grid := model.Room{Columns: 3, Ring: true}
+	row := model.Room{Ring: true}
+	all := []int{1, 2, 3, 4, 5, 6, 7}
+	cases := []struct {
+		room model.Room
+		ids  []int
+		me   int
+		d    model.Direction
+		want int
+		ok   bool
+	}{
+		{row, all, 7, model.Right, 1, true},
+		{row, all, 1, model.Left, 7, true},
+		{row, all, 4, model.Up, 0, false},
+		{row, []int{1, 2}, 1, model.Left, 2, true},
+		{row, []int{1, 2}, 1, model.Right, 2, true},
+		{row, []int{1}, 1, model.Right, 0, false},
+		{grid, all, 3, model.Right, 1, true},
+		{grid, all, 4, model.Left, 6, true},
+		{grid, all, 1, model.Up, 7, true},
+		{grid, all, 7, model.Down, 1, true},
+		{grid, all, 3, model.Down, 6, true},
+		{grid, all, 6, model.Down, 3, true},
+		{grid, all, 7, model.Left, 0, false},
+	}
+	for _, c := range cases {
+		others := []int{}
+		for _, id := range c.ids {
+			if id != c.me {
+				others = append(others, id)
+			}
+		}
+		got, ok := Neighbor(c.room, c.me, others, c.d)
+		if ok != c.ok || got != c.want {
+			t.Errorf("Neighbor(%v, %d, %v) = %d, %v; want %d, %v",
+				c.room, c.me, c.d, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestDoors(t *testing.T) {
+	cases := []struct {
+		room   model.Room
+		me     int
+		others []int
+		left   model.DoorState
+		right  model.DoorState
+		up     model.DoorState
+		down   model.DoorState
+	}{
+		{model.Room{}, 1, []int{},
+			model.Closed, model.Closed, model.Closed, model.Closed},
+		{model.Room{}, 1, []int{2, 3},
+			model.Closed, model.Open, model.Closed, model.Closed},
+		{model.Room{}, 2, []int{1, 3},
+			model.Open, model.Open, model.Closed, model.Closed},
+		{model.Room{}, 3, []int{1, 2},
+			model.Open, model.Closed, model.Closed, model.Closed},
+		{model.Room{Columns: 2}, 1, []int{2, 3, 4},
+			model.Closed, model.Open, model.Closed, model.Open},
+		{model.Room{Columns: 2}, 4, []int{1, 2, 3},
+			model.Open, model.Closed, model.Open, model.Closed},
+		{model.Room{Columns: 1}, 2, []int{1, 3},
+			model.Closed, model.Closed, model.Open, model.Open},
+		{model.Room{Ring: true}, 1, []int{2, 3},
+			model.Open, model.Open, model.Closed, model.Closed},
+	}
+	for _, c := range cases {
+		dcs := Doors(c.room, c.me, c.others)
+		want := []model.DoorCommand{
+			model.WholeDoor(c.left, model.Left),
+			model.WholeDoor(c.right, model.Right),
+			model.WholeDoor(c.up, model.Up),
+			model.WholeDoor(c.down, model.Down),
+		}
+		if len(dcs) != len(want) {
+			t.Errorf("Doors(%v, %d, %v) = %v, want %v",
+				c.room, c.me, c.others, dcs, want)
+			continue
+		}
+		for i := range want {
+			if dcs[i] != want[i] {
+				t.Errorf("Doors(%v, %d, %v) = %v, want %v",
+					c.room, c.me, c.others, dcs, want)
+				break
+			}
+		}
+	}
+}
+
+// A tablet between two phones, with a third phone below the tablet,
+// launched in no particular order:
+//
+//	+---+ +-------+ +---+
+//	| 3 | |   1   | | 2 |
+//	+---+ |       | +---+
+//	      +-------+
+//	        +---+
+//	        | 4 |
+//	        +---+
+func TestLayoutNeighbor(t *testing.T) {
+	room := model.Room{Slots: []model.Slot{
+		{Id: 1, X: 70, Y: 0, W: 200, H: 150},
+		{Id: 2, X: 280, Y: 0, W: 60, H: 110},
+		{Id: 3, X: 0, Y: 0, W: 60, H: 110},
+		{Id: 4, X: 140, Y: 160, W: 60, H: 110},
+	}}
+	ring := room
+	ring.Ring = true
+	all := []int{1, 2, 3, 4, 5}
+	cases := []struct {
+		room model.Room
+		me   int
+		d    model.Direction
+		want int
+		ok   bool
+	}{
+		{room, 1, model.Left, 3, true},
+		{room, 1, model.Right, 2, true},
+		{room, 1, model.Down, 4, true},
+		{room, 4, model.Up, 1, true},
+		{room, 3, model.Right, 1, true},
+		{room, 3, model.Left, 0, false},
+		{room, 4, model.Left, 0, false},
+		{room, 2, model.Down, 0, false},
+		// Has no slot, so stands apart.
+		{room, 5, model.Left, 0, false},
+		{ring, 2, model.Right, 3, true},
+		{ring, 3, model.Left, 2, true},
+		{ring, 4, model.Down, 1, true},
+		{ring, 4, model.Left, 0, false},
+	}
+	for _, c := range cases {
+		others := []int{}
+		for _, id := range all {
+			if id != c.me {
+				others = append(others, id)
+			}
+		}
+		got, ok := Neighbor(c.room, c.me, others, c.d)
+		if ok != c.ok || got != c.want {
+			t.Errorf("Neighbor(%v, %d, %v) = %d, %v; want %d, %v",
+				c.room, c.me, c.d, got, ok, c.want, c.ok)
+		}
+	}
+	// Players that left don't count.
+	if got, ok := Neighbor(room, 1, []int{3, 4}, model.Right); ok {
+		t.Errorf("got right neighbor %d after 2 left", got)
+	}
+}
+
+// A phone standing beside the lower part of a tablet:
+//
+//	+-------+
+//	|   1   |
+//	|       | +---+
+//	|       | | 2 |
+//	+-------+ +---+
+func phoneBesideTablet() model.Room {
+	return model.Room{Slots: []model.Slot{
+		{Id: 1, X: 0, Y: 0, W: 200, H: 160},
+		{Id: 2, X: 200, Y: 80, W: 60, H: 80},
+	}}
+}
+
+func TestDoorSpansFacingEdge(t *testing.T) {
+	room := phoneBesideTablet()
+	if dc := Doors(room, 1, []int{2})[1]; dc.S != model.Open ||
+		dc.Lo != 0.5 || dc.Hi != 1 {
+		t.Errorf("got tablet's right door %v, want open over [0.5,1]", dc)
+	}
+	if dc := Doors(room, 2, []int{1})[0]; dc.S != model.Open ||
+		dc.Lo != 0 || dc.Hi != 1 {
+		t.Errorf("got phone's left door %v, want open over [0,1]", dc)
+	}
+}
+
+func TestCrossKeepsPlaceAndSpeed(t *testing.T) {
+	room := phoneBesideTablet()
+	// Leaving the tablet three quarters of the way down, so 120mm from
+	// the top: half way down the phone.
+	p, v, ok := Cross(room, 1, 2, model.Right,
+		model.Vec{1, 0.75}, model.Vec{0.25, 0.5})
+	if !ok || p.X != 0 || p.Y != 0.5 {
+		t.Fatalf("got %v, %v; want {0, 0.5}, true", p.String(), ok)
+	}
+	// A quarter of the tablet's 200mm a step is 50mm, or five sixths
+	// of the phone's 60mm.
+	if v.X != 50.0/60 || v.Y != 0.5*160/80 {
+		t.Errorf("got vel %v", v.String())
+	}
+	// And back again.
+	p, _, ok = Cross(room, 2, 1, model.Left, model.Vec{0, 0.25}, v)
+	if !ok || p.X != 1 || p.Y != 0.625 {
+		t.Errorf("got %v, %v; want {1, 0.625}, true", p.String(), ok)
+	}
+	if _, _, ok := Cross(model.Room{}, 1, 2, model.Right,
+		model.Vec{1, 0.75}, v); ok {
+		t.Errorf("mapped a ball in a room without a layout")
+	}
+}
+
+func TestRows(t *testing.T) {
+	ids := []int{5, 1, 7, 3}
+	// 1 and 3 side by side, 7 a little lower but still level with 1,
+	// 5 below them all, and 9 with no slot.
+	layout := model.Room{Slots: []model.Slot{
+		{1, 0, 0, 100, 60},
+		{3, 200, 0, 100, 60},
+		{7, 100, 20, 100, 60},
+		{5, 0, 100, 100, 60},
+	}}
+	cases := []struct {
+		room model.Room
+		ids  []int
+		want [][]int
+	}{
+		{model.Room{}, ids, [][]int{{1, 3, 5, 7}}},
+		{model.Room{Columns: 3}, ids, [][]int{{1, 3, 5}, {7}}},
+		{model.Room{}, nil, [][]int{}},
+		{layout, append(ids, 9), [][]int{{1, 7, 3}, {5}, {9}}},
+	}
+	for _, c := range cases {
+		if got := Rows(c.room, c.ids); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Rows(%v, %v) = %v, want %v", c.room, c.ids, got, c.want)
+		}
+	}
+}
+
+func TestPicks(t *testing.T) {
+	ids := []int{5, 1, 7, 3}
+	layout := model.Room{Slots: []model.Slot{
+		{1, 0, 0, 100, 60},
+		{3, 200, 0, 100, 60},
+		{7, 100, 20, 100, 60},
+		{5, 0, 100, 100, 60},
+	}}
+	left := model.Target{Half: model.LeftHalf}
+	right := model.Target{Half: model.RightHalf}
+	cases := []struct {
+		room model.Room
+		t    model.Target
+		ids  []int
+		want []int
+	}{
+		{model.Room{}, model.Everyone, ids, []int{1, 3, 5, 7}},
+		{model.Room{}, model.Target{Ids: []int{3, 9}}, ids, []int{3}},
+		{model.Room{}, model.Target{Lo: 3, Hi: 5}, ids, []int{3, 5}},
+		{model.Room{}, model.Target{Ids: []int{1}, Lo: 5, Hi: 9}, ids,
+			[]int{1, 5, 7}},
+		{model.Room{}, left, ids, []int{1, 3}},
+		{model.Room{}, right, ids, []int{5, 7}},
+		{model.Room{}, model.Target{Lo: 3, Hi: 7, Half: model.LeftHalf}, ids,
+			[]int{3}},
+		// The middle column is in neither half, and 7 is on the left
+		// of a short last row.
+		{model.Room{Columns: 3}, left, ids, []int{1, 7}},
+		{model.Room{Columns: 3}, right, ids, []int{5}},
+		// 1, 7 and 3 in a row, 5 and 9 alone.
+		{layout, left, append(ids, 9), []int{1}},
+		{layout, right, append(ids, 9), []int{3}},
+	}
+	for _, c := range cases {
+		got := []int{}
+		for i, me := range c.ids {
+			others := append(append([]int{}, c.ids[:i]...), c.ids[i+1:]...)
+			if Picks(c.room, c.t, me, others) {
+				got = append(got, me)
+			}
+		}
+		sort.Ints(got)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%v in %v picks %v, want %v", c.t, c.room, got, c.want)
+		}
+	}
+}
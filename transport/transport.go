@@ -0,0 +1,59 @@
+// Package transport builds the transport that players and the master
+// reach each other with, as their shared flags say.
+package transport
+
+import (
+	"flag"
+	"github.com/monopole/volley/config"
+	"github.com/monopole/volley/discovery"
+	"github.com/monopole/volley/net"
+	"github.com/monopole/volley/peer"
+	"github.com/monopole/volley/tcp"
+	"log"
+)
+
+// Flags say how to reach the other players, and where to find them.
+type Flags struct {
+	Kind   *string // v23 or tcp.
+	NsRoot *string // As host:port; found on the local network if empty.
+	HostNs *bool
+}
+
+// RegisterFlags defines the transport flags on fs.
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	return &Flags{
+		fs.String(
+			"transport", config.Transport,
+			"How players reach each other: v23, or tcp for JSON over plain TCP."),
+		fs.String(
+			"ns-root", "",
+			"Namespace root as host:port; found on the local network if not given."),
+		fs.Bool(
+			"host-ns", false,
+			"Run a mounttable in this process and announce it on the local network."),
+	}
+}
+
+// FindRoot returns the namespace root the flags give, or discovery
+// finds, and whether this process is to host it.  Finding it may wait
+// seconds on a beacon.
+func FindRoot(f *Flags, isGameMaster bool) (root string, host bool) {
+	return discovery.DetermineRoot(*f.NsRoot, *f.HostNs, isGameMaster)
+}
+
+// New returns the transport the flags ask for, reaching the others
+// through the directory at root, which it hosts if host.
+func New(f *Flags, root string, host bool, isGameMaster bool) peer.Transport {
+	switch *f.Kind {
+	case "v23":
+		nsRoot := "/" + root
+		log.Printf("Using v23.namespace.root=%s", nsRoot)
+		return net.NewV23Transport(
+			config.Chatty, config.RootName, isGameMaster, nsRoot, host)
+	case "tcp":
+		log.Printf("Using registry at %s", root)
+		return tcp.NewTransport(config.Chatty, isGameMaster, root, host)
+	}
+	log.Fatalf("Don't understand transport: %s", *f.Kind)
+	return nil
+}
@@ -3,21 +3,40 @@
 package main
 
 import (
+	"flag"
 	"github.com/monopole/volley/config"
 	"github.com/monopole/volley/engine"
-	"github.com/monopole/volley/net"
+	"github.com/monopole/volley/peer"
+	"github.com/monopole/volley/transport"
 	"golang.org/x/mobile/app"
-	"log"
 )
 
+// How to reach the other players.
+var netFlags = transport.RegisterFlags(flag.CommandLine)
+
+// A transport that finds the directory of players only once opened.
+// Finding it may wait seconds on a beacon, and the manager opens its
+// transport off the app's event loop, so the window comes up meanwhile.
+type foundTransport struct {
+	peer.Transport // Nil until opened.
+}
+
+func (t *foundTransport) Open() error {
+	root, host := transport.FindRoot(netFlags, false)
+	t.Transport = transport.New(netFlags, root, host, false)
+	return t.Transport.Open()
+}
+
+func (t *foundTransport) Close() {
+	if t.Transport != nil {
+		t.Transport.Close()
+	}
+}
+
 func main() {
+	flag.Parse()
 	app.Main(func(a app.App) {
-		nsRoot := "/" + net.DetermineNamespaceRoot()
-		log.Printf("Using v23.namespace.root=%s", nsRoot)
-		engine.NewEngine(
-			config.Chatty,
-			net.NewV23Manager(
-				config.Chatty, config.RootName, false, nsRoot),
-		).Run(a)
+		nm := peer.NewManager(config.Chatty, false, &foundTransport{})
+		engine.NewEngine(config.Chatty, nm).Run(a)
 	})
 }